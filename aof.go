@@ -0,0 +1,603 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The append-only log is a sequence of records, each a big-endian uint64
+// length, the big-endian CRC-32C of the length, the big-endian CRC-32C of the
+// payload, and a payload of that length. The checksum of the length tells a
+// record cut short at the end of the log, whose length is intact but runs past
+// the end of the file, from a corrupt length. The first byte of the payload is
+// the operation:
+//
+//   - aofSet: the key and item, encoded with the log's codec.
+//   - aofDelete: the key.
+//   - aofFlush: nothing else.
+//   - aofSnapshot: a snapshot as written by SaveWith. A rewritten log starts
+//     with one.
+//
+// Every record holds the full state of the key it changes, so replaying a
+// record twice has the same effect as replaying it once.
+const (
+	aofSet byte = iota + 1
+	aofDelete
+	aofFlush
+	aofSnapshot
+)
+
+const aofRecordHeaderSize = 16
+
+// FsyncPolicy selects how often the append-only log is synced to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncEverySecond syncs the log once a second, so at most a second of
+	// changes is lost if the machine crashes.
+	FsyncEverySecond FsyncPolicy = iota
+	// FsyncAlways syncs the log after every change, while the cache's lock is
+	// held. No change is lost, but every write waits for the disk.
+	FsyncAlways
+	// FsyncNever leaves syncing to the operating system.
+	FsyncNever
+)
+
+const (
+	defaultRewriteMinSize    = 64 << 20
+	defaultRewritePercentage = 100
+)
+
+// AOFOptions configures the append-only log opened by OpenAOF.
+type AOFOptions struct {
+	Fsync FsyncPolicy
+	// Codec encodes the logged items. Defaults to GobCodec.
+	Codec Codec
+	// RewritePercentage is how much the log must have grown since it was last
+	// rewritten, in percent of its size after the rewrite, for it to be
+	// rewritten in the background. Defaults to 100; a negative value disables
+	// automatic rewrites.
+	RewritePercentage int
+	// RewriteMinSize is the size below which the log isn't rewritten
+	// automatically. Defaults to 64 MiB.
+	RewriteMinSize int64
+	// OnError, if set, is called when a change can't be written to the log or
+	// a background rewrite fails. Changes that can't be written are lost, but
+	// the cache keeps working. A record that was only partly written is
+	// removed from the log; if that fails, no more changes are logged until
+	// the log is rewritten.
+	OnError func(err error)
+}
+
+// OpenAOF replays the append-only log in the file fname into the cache, then
+// logs every change to the cache to it: every Set, Delete, Increment and
+// other modification, every item removed by DeleteExpired or the janitor, and
+// Flush. Replayed items replace existing items with the same key. The file is
+// created if it doesn't exist. A record that was cut short at the end of the
+// file, e.g. by a crash, is removed; a corrupt record makes OpenAOF fail with
+// an error wrapping ErrCorruptLog, without changing the cache or the file.
+// The log is applied to the cache only once all of it was read. Values stored by
+// GetOrLoad aren't logged. Any log already open is closed first, and Close
+// closes the log.
+func (c *Cache) OpenAOF(fname string, opts AOFOptions) error {
+	if opts.Codec == nil {
+		opts.Codec = GobCodec
+	}
+	if opts.RewritePercentage == 0 {
+		opts.RewritePercentage = defaultRewritePercentage
+	}
+	if opts.RewriteMinSize <= 0 {
+		opts.RewriteMinSize = defaultRewriteMinSize
+	}
+	if err := c.CloseAOF(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	size, err := c.replayAOF(f, opts.Codec)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l := &appendLog{
+		c:           c,
+		fname:       fname,
+		opts:        opts,
+		f:           f,
+		size:        size,
+		rewriteSize: size,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	c.mu.Lock()
+	c.aof = l
+	c.mu.Unlock()
+	go l.run()
+	return nil
+}
+
+// CloseAOF waits for a background rewrite of the append-only log to finish,
+// syncs the log and closes it. It returns the first error that occurred while
+// writing to the log, if any. CloseAOF does nothing if no log is open.
+func (c *Cache) CloseAOF() error {
+	c.mu.Lock()
+	l := c.aof
+	c.aof = nil
+	c.mu.Unlock()
+	if l == nil {
+		return nil
+	}
+	return l.close()
+}
+
+// RewriteAOF rewrites the append-only log as a snapshot of the cache followed
+// by the changes made while the snapshot was written, and waits for it to
+// finish. The cache can be used while the log is rewritten. If a rewrite is
+// already running, RewriteAOF waits for it and starts another one.
+func (c *Cache) RewriteAOF() error {
+	c.mu.RLock()
+	l := c.aof
+	c.mu.RUnlock()
+	if l == nil {
+		return errors.New("No append-only log is open")
+	}
+	return l.rewrite()
+}
+
+// replayAOF applies the records in f to the cache and returns the offset of
+// the end of the last complete record. The records are read into an
+// aofReplay first, so the cache is left unchanged if one is corrupt.
+func (c *Cache) replayAOF(f *os.File, codec Codec) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	replay := aofReplay{changes: make(map[string]*Item)}
+	var offset int64
+	for {
+		payload, n, err := readAOFRecord(r, info.Size()-offset)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return offset, fmt.Errorf("%w: record at offset %d: %v", ErrCorruptLog, offset, err)
+		}
+		if err := replay.add(payload, codec); err != nil {
+			return offset, fmt.Errorf("%w: record at offset %d: %v", ErrCorruptLog, offset, err)
+		}
+		offset += n
+	}
+	c.mu.Lock()
+	replay.apply(c)
+	c.mu.Unlock()
+	return offset, nil
+}
+
+// readAOFRecord reads a record, which must fit in the next size bytes of r,
+// and returns its payload and size. The error is io.EOF at the end of the log,
+// including when the last record was cut short: its header is incomplete, or
+// it is intact and declares a record longer than the rest of the log.
+func readAOFRecord(r io.Reader, size int64) ([]byte, int64, error) {
+	var header [aofRecordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, err
+	}
+	if crc32.Checksum(header[:8], crc32c) != binary.BigEndian.Uint32(header[8:12]) {
+		return nil, 0, errors.New("length checksum mismatch")
+	}
+	length := binary.BigEndian.Uint64(header[:8])
+	if length > uint64(size-aofRecordHeaderSize) {
+		return nil, 0, io.EOF
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+	if crc32.Checksum(payload, crc32c) != binary.BigEndian.Uint32(header[12:]) {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+	if len(payload) == 0 {
+		return nil, 0, errors.New("empty record")
+	}
+	return payload, aofRecordHeaderSize + int64(length), nil
+}
+
+// aofReplay holds the changes read from a log until they are applied to the
+// cache.
+type aofReplay struct {
+	// flushed is set if the log deletes all items.
+	flushed bool
+	// changes holds the last state of every key changed by the log after it
+	// deleted all items, if it did. A nil Item means the key was deleted.
+	changes map[string]*Item
+}
+
+func (r *aofReplay) add(payload []byte, codec Codec) error {
+	data := payload[1:]
+	switch payload[0] {
+	case aofSet:
+		k, item, err := codec.NewDecoder(bytes.NewReader(data)).Decode()
+		if err != nil {
+			return err
+		}
+		r.changes[k] = &item
+	case aofDelete:
+		r.changes[string(data)] = nil
+	case aofFlush:
+		r.flushed = true
+		r.changes = make(map[string]*Item)
+	case aofSnapshot:
+		_, items, err := decodeSnapshot(bytes.NewReader(data), LoadOptions{Codec: codec})
+		if err != nil {
+			return err
+		}
+		for k, item := range items {
+			r.changes[k] = &item
+		}
+	default:
+		return fmt.Errorf("unknown operation %d", payload[0])
+	}
+	return nil
+}
+
+// apply applies the changes to c. The caller must hold c.mu.
+func (r *aofReplay) apply(c *Cache) {
+	if r.flushed {
+		c.items = make(map[string]Item)
+	}
+	for k, item := range r.changes {
+		if item == nil {
+			c.remove(k)
+		} else {
+			c.replayItem(k, *item)
+		}
+	}
+}
+
+// replayItem stores a replayed item, or removes the key if the item has
+// expired since it was logged. The caller must hold c.mu.
+func (c *Cache) replayItem(k string, item Item) {
+	if item.Expired() {
+		c.remove(k)
+		return
+	}
+	c.put(k, item)
+}
+
+// appendRecord appends a record with the given operation and data to buf.
+func appendRecord(buf *bytes.Buffer, op byte, data []byte) {
+	crc := crc32.Update(crc32.Checksum([]byte{op}, crc32c), crc32c, data)
+	header := aofRecordHeader(uint64(len(data)+1), crc)
+	buf.Write(header[:])
+	buf.WriteByte(op)
+	buf.Write(data)
+}
+
+// aofRecordHeader returns the header of a record with the given payload
+// length and checksum.
+func aofRecordHeader(length uint64, crc uint32) [aofRecordHeaderSize]byte {
+	var header [aofRecordHeaderSize]byte
+	binary.BigEndian.PutUint64(header[:8], length)
+	binary.BigEndian.PutUint32(header[8:12], crc32.Checksum(header[:8], crc32c))
+	binary.BigEndian.PutUint32(header[12:], crc)
+	return header
+}
+
+type appendLog struct {
+	c     *Cache
+	fname string
+	opts  AOFOptions
+
+	// mu guards the fields below. Changes are logged while the cache's lock
+	// is held, so mu must never be held while acquiring the cache's lock.
+	mu sync.Mutex
+	f  *os.File
+	// size is the size of the log, and rewriteSize its size after it was last
+	// rewritten or opened.
+	size        int64
+	rewriteSize int64
+	dirty       bool
+	err         error
+	// broken is set when a record was only partly written and couldn't be
+	// removed again. Nothing more is appended until the log is rewritten, as
+	// the records would follow the partial one and be lost on replay.
+	broken bool
+	// rewriteBuf, if set, collects the records logged while the log is being
+	// rewritten.
+	rewriteBuf *bytes.Buffer
+	// autoRewrite is set while an automatic rewrite is running.
+	autoRewrite bool
+	rewriting   sync.Mutex
+	stop        chan struct{}
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// written logs that item was stored under k. The caller must hold c.mu.
+func (l *appendLog) written(k string, item Item) {
+	data, err := encodeAOFItem(l.opts.Codec, k, item)
+	if err != nil {
+		l.failed(fmt.Errorf("Can't log %s: %w", k, err))
+		return
+	}
+	l.append(aofSet, data)
+}
+
+// encodeAOFItem encodes k and item with codec. A codec that panics, e.g.
+// because gob.Register rejects the item's type, fails with an error instead,
+// since the cache's lock is held while changes are logged.
+func encodeAOFItem(codec Codec, k string, item Item) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf).Encode(k, item); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deleted logs that k was deleted or expired. The caller must hold c.mu.
+func (l *appendLog) deleted(k string) {
+	l.append(aofDelete, []byte(k))
+}
+
+// flushed logs that all items were deleted. The caller must hold c.mu.
+func (l *appendLog) flushed() {
+	l.append(aofFlush, nil)
+}
+
+func (l *appendLog) append(op byte, data []byte) {
+	var rec bytes.Buffer
+	appendRecord(&rec, op, data)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rewriteBuf != nil {
+		l.rewriteBuf.Write(rec.Bytes())
+	}
+	if l.broken {
+		l.failedLocked(errors.New("Append-only log has a partial record and must be rewritten"))
+		return
+	}
+	n, err := l.f.Write(rec.Bytes())
+	if err != nil {
+		if n > 0 {
+			l.truncate(l.size)
+		}
+		l.failedLocked(err)
+		return
+	}
+	l.size += int64(n)
+	if l.opts.Fsync == FsyncAlways {
+		if err := l.f.Sync(); err != nil {
+			l.failedLocked(err)
+			return
+		}
+	}
+	l.dirty = true
+	if l.needsRewrite() {
+		l.autoRewrite = true
+		l.wg.Add(1)
+		go l.rewriteInBackground()
+	}
+}
+
+// failed records err and passes it to OnError.
+// truncate removes a partly written record from the end of the log, which
+// must be size bytes long without it, or marks the log broken if it can't.
+// The caller must hold l.mu.
+func (l *appendLog) truncate(size int64) {
+	err := l.f.Truncate(size)
+	if err == nil {
+		_, err = l.f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		l.broken = true
+		l.failedLocked(fmt.Errorf("Can't remove a partial record from the append-only log: %w", err))
+	}
+}
+
+func (l *appendLog) failed(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failedLocked(err)
+}
+
+func (l *appendLog) failedLocked(err error) {
+	if l.err == nil {
+		l.err = err
+	}
+	if l.opts.OnError != nil {
+		l.opts.OnError(err)
+	}
+}
+
+// needsRewrite reports whether the log has grown enough to be rewritten
+// automatically. The caller must hold l.mu.
+func (l *appendLog) needsRewrite() bool {
+	if l.opts.RewritePercentage < 0 || l.autoRewrite {
+		return false
+	}
+	return l.size >= l.opts.RewriteMinSize &&
+		l.size >= l.rewriteSize+l.rewriteSize*int64(l.opts.RewritePercentage)/100
+}
+
+func (l *appendLog) rewriteInBackground() {
+	defer l.wg.Done()
+	err := l.rewrite()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.autoRewrite = false
+	if err != nil {
+		// Wait for the log to grow again before retrying.
+		l.rewriteSize = l.size
+		l.failedLocked(fmt.Errorf("Can't rewrite append-only log: %w", err))
+	}
+}
+
+// run syncs the log every second, if the policy is FsyncEverySecond, and
+// starts background rewrites.
+func (l *appendLog) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if l.opts.Fsync == FsyncEverySecond {
+				l.sync()
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+func (l *appendLog) sync() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.dirty {
+		return
+	}
+	if err := l.f.Sync(); err != nil {
+		l.failedLocked(err)
+		return
+	}
+	l.dirty = false
+}
+
+// rewrite writes a snapshot of c to a temporary file, appends the records
+// logged meanwhile, and renames the file over the log. The records logged
+// before the snapshot starts are both in the snapshot and in the buffer,
+// which is harmless since replaying them again doesn't change the result.
+func (l *appendLog) rewrite() error {
+	l.rewriting.Lock()
+	defer l.rewriting.Unlock()
+	l.mu.Lock()
+	if l.f == nil {
+		l.mu.Unlock()
+		return errors.New("Append-only log is closed")
+	}
+	l.rewriteBuf = &bytes.Buffer{}
+	l.mu.Unlock()
+
+	tmp, err := l.writeRewrite()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	buf := l.rewriteBuf
+	l.rewriteBuf = nil
+	if err == nil {
+		_, err = tmp.Write(buf.Bytes())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.fname)
+	}
+	if err != nil {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		return err
+	}
+	// The old file is gone once the rename succeeded, so switch to the new
+	// one even if the rename can't be made durable.
+	l.f.Close()
+	l.f = tmp
+	l.size, _ = tmp.Seek(0, io.SeekEnd)
+	l.rewriteSize = l.size
+	l.dirty = false
+	l.broken = false
+	return syncDir(filepath.Dir(l.fname))
+}
+
+// writeRewrite writes a snapshot record of the cache to a new temporary file
+// next to the log. The snapshot is streamed to the file, and the record header
+// filled in afterwards.
+func (l *appendLog) writeRewrite() (*os.File, error) {
+	dir, base := filepath.Split(l.fname)
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	crc := crc32.New(crc32c)
+	w := &countingWriter{w: bufio.NewWriter(io.MultiWriter(tmp, crc))}
+	var header [aofRecordHeaderSize]byte
+	_, err = tmp.Write(header[:])
+	if err == nil {
+		w.Write([]byte{aofSnapshot})
+		err = l.c.SaveWith(w, l.opts.Codec)
+	}
+	if err == nil {
+		err = w.w.(*bufio.Writer).Flush()
+	}
+	if err == nil {
+		header = aofRecordHeader(uint64(w.n), crc.Sum32())
+		_, err = tmp.WriteAt(header[:], 0)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekEnd)
+	}
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (l *appendLog) close() error {
+	close(l.stop)
+	<-l.done
+	l.wg.Wait()
+	l.rewriting.Lock()
+	defer l.rewriting.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.err
+	if l.opts.Fsync != FsyncNever {
+		err = errors.Join(err, l.f.Sync())
+	}
+	err = errors.Join(err, l.f.Close())
+	l.f = nil
+	return err
+}
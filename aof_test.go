@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_OpenAOF(t *testing.T) {
+	open := func(t *testing.T, fname string, opts AOFOptions) *Cache {
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.OpenAOF(fname, opts))
+		return c
+	}
+
+	t.Run("Replay logged changes", func(t *testing.T) {
+		for _, policy := range []FsyncPolicy{FsyncEverySecond, FsyncAlways, FsyncNever} {
+			fname := filepath.Join(t.TempDir(), "cache.aof")
+			c := open(t, fname, AOFOptions{Fsync: policy})
+			c.Set("a", 1, NoExpiration)
+			c.Set("b", "two", NoExpiration)
+			c.Set("c", 3, NoExpiration)
+			_, _ = c.HSet("hash", "field", "value")
+			c.Delete("c")
+			_, err := c.IncrementInt("a", 41)
+			assert.NoError(t, err)
+			assert.NoError(t, c.Close())
+
+			c = open(t, fname, AOFOptions{Fsync: policy})
+			assert.Equal(t, map[string]any{"a": 42, "b": "two", "hash": map[string]string{"field": "value"}}, itemObjects(c.Items()))
+
+			c.Flush()
+			c.Set("d", 4, NoExpiration)
+			assert.NoError(t, c.Close())
+			c = open(t, fname, AOFOptions{Fsync: policy})
+			assert.Equal(t, map[string]any{"d": 4}, itemObjects(c.Items()))
+			assert.NoError(t, c.Close())
+		}
+	})
+
+	t.Run("Log expired items", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := open(t, fname, AOFOptions{})
+		c.Set("short", 1, 10*time.Millisecond)
+		c.Set("long", 2, time.Hour)
+		time.Sleep(20 * time.Millisecond)
+		c.DeleteExpired()
+		size := fileSize(t, fname)
+		assert.NoError(t, c.Close())
+
+		c = open(t, fname, AOFOptions{})
+		assert.Equal(t, map[string]any{"long": 2}, itemObjects(c.Items()))
+		assert.NoError(t, c.Close())
+		assert.Equal(t, size, fileSize(t, fname))
+	})
+
+	t.Run("Remove a record cut short by a crash", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := open(t, fname, AOFOptions{})
+		c.Set("a", 1, NoExpiration)
+		size := fileSize(t, fname)
+		c.Set("b", 2, NoExpiration)
+		assert.NoError(t, c.Close())
+		assert.NoError(t, os.Truncate(fname, fileSize(t, fname)-3))
+
+		c = open(t, fname, AOFOptions{})
+		assert.Equal(t, map[string]any{"a": 1}, itemObjects(c.Items()))
+		assert.Equal(t, size, fileSize(t, fname))
+		c.Set("c", 3, NoExpiration)
+		assert.NoError(t, c.Close())
+
+		c = open(t, fname, AOFOptions{})
+		assert.Equal(t, map[string]any{"a": 1, "c": 3}, itemObjects(c.Items()))
+		assert.NoError(t, c.Close())
+	})
+
+	t.Run("Reject corrupt records", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := open(t, fname, AOFOptions{})
+		c.Set("a", 1, NoExpiration)
+		c.Set("b", 2, NoExpiration)
+		assert.NoError(t, c.Close())
+		data, err := os.ReadFile(fname)
+		assert.NoError(t, err)
+		data[aofRecordHeaderSize+2] ^= 0xff
+		assert.NoError(t, os.WriteFile(fname, data, 0644))
+
+		err = New(DefaultExpiration, 0).OpenAOF(fname, AOFOptions{})
+		assert.ErrorIs(t, err, ErrCorruptLog)
+		assert.ErrorContains(t, err, "offset 0")
+	})
+
+	t.Run("Reject a corrupt length in the middle of the log", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := open(t, fname, AOFOptions{})
+		c.Set("a", 1, NoExpiration)
+		second := fileSize(t, fname)
+		c.Set("b", 2, NoExpiration)
+		c.Set("c", 3, NoExpiration)
+		assert.NoError(t, c.Close())
+		data, err := os.ReadFile(fname)
+		assert.NoError(t, err)
+		data[second] |= 0x80
+		assert.NoError(t, os.WriteFile(fname, data, 0644))
+
+		c = New(DefaultExpiration, 0)
+		c.Set("x", 0, NoExpiration)
+		err = c.OpenAOF(fname, AOFOptions{})
+		assert.ErrorIs(t, err, ErrCorruptLog)
+		assert.ErrorContains(t, err, fmt.Sprintf("offset %d", second))
+		assert.Equal(t, map[string]any{"x": 0}, itemObjects(c.Items()))
+		assert.Equal(t, int64(len(data)), fileSize(t, fname))
+	})
+
+	t.Run("Log nil values", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := open(t, fname, AOFOptions{})
+		c.Set("a", nil, NoExpiration)
+		assert.NoError(t, c.Close())
+
+		c = open(t, fname, AOFOptions{})
+		val, found := c.Get("a")
+		assert.True(t, found)
+		assert.Nil(t, val)
+		assert.NoError(t, c.Close())
+	})
+
+	t.Run("Report values the codec can't encode", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		var errs []error
+		c := open(t, fname, AOFOptions{OnError: func(err error) { errs = append(errs, err) }})
+		c.Set("a", func() {}, NoExpiration)
+		c.Set("b", 2, NoExpiration)
+
+		assert.Len(t, errs, 1)
+		assert.ErrorContains(t, c.Close(), "Can't log a")
+		c = open(t, fname, AOFOptions{})
+		assert.Equal(t, map[string]any{"b": 2}, itemObjects(c.Items()))
+		assert.NoError(t, c.Close())
+	})
+
+	t.Run("Remove a partial record after a failed write", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := open(t, fname, AOFOptions{})
+		c.Set("a", 1, NoExpiration)
+		l := c.aof
+		l.mu.Lock()
+		_, err := l.f.Write([]byte("partial"))
+		assert.NoError(t, err)
+		l.truncate(l.size)
+		l.mu.Unlock()
+
+		c.Set("b", 2, NoExpiration)
+		assert.NoError(t, c.Close())
+		c = open(t, fname, AOFOptions{})
+		assert.Equal(t, map[string]any{"a": 1, "b": 2}, itemObjects(c.Items()))
+		assert.NoError(t, c.Close())
+	})
+
+	t.Run("Stop appending after a partial record until the log is rewritten", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		var errs []error
+		c := open(t, fname, AOFOptions{OnError: func(err error) { errs = append(errs, err) }})
+		c.Set("a", 1, NoExpiration)
+
+		// Truncating a read-only file fails, so the log is marked broken.
+		ro, err := os.Open(fname)
+		assert.NoError(t, err)
+		defer ro.Close()
+		l := c.aof
+		l.mu.Lock()
+		f := l.f
+		l.f = ro
+		l.truncate(l.size)
+		l.f = f
+		l.mu.Unlock()
+		assert.Len(t, errs, 1)
+
+		size := fileSize(t, fname)
+		c.Set("b", 2, NoExpiration)
+		assert.Len(t, errs, 2)
+		assert.Equal(t, size, fileSize(t, fname))
+
+		assert.NoError(t, c.RewriteAOF())
+		c.Set("c", 3, NoExpiration)
+		assert.Len(t, errs, 2)
+		assert.Error(t, c.Close())
+
+		c = open(t, fname, AOFOptions{})
+		assert.Equal(t, map[string]any{"a": 1, "b": 2, "c": 3}, itemObjects(c.Items()))
+		assert.NoError(t, c.Close())
+	})
+}
+
+func TestCache_RewriteAOF(t *testing.T) {
+	t.Run("Compact the log", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.OpenAOF(fname, AOFOptions{}))
+		for i := 0; i < 100; i++ {
+			c.Set(fmt.Sprintf("key%d", i%10), i, NoExpiration)
+		}
+		size := fileSize(t, fname)
+		assert.NoError(t, c.RewriteAOF())
+		assert.Less(t, fileSize(t, fname), size)
+
+		c.Delete("key0")
+		assert.NoError(t, c.Close())
+		assert.Error(t, c.RewriteAOF())
+
+		c = New(DefaultExpiration, 0)
+		assert.NoError(t, c.OpenAOF(fname, AOFOptions{}))
+		assert.Equal(t, 9, c.ItemCount())
+		val, _ := c.Get("key9")
+		assert.Equal(t, 99, val)
+		assert.NoError(t, c.Close())
+	})
+
+	t.Run("Keep changes made during the rewrite", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.OpenAOF(fname, AOFOptions{}))
+		for i := 0; i < 5*saveChunkSize; i++ {
+			c.Set(fmt.Sprintf("key%d", i), i, NoExpiration)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5*saveChunkSize; i++ {
+				c.Set(fmt.Sprintf("key%d", i), -i, NoExpiration)
+			}
+		}()
+		assert.NoError(t, c.RewriteAOF())
+		wg.Wait()
+		want := itemObjects(c.Items())
+		assert.NoError(t, c.Close())
+
+		c = New(DefaultExpiration, 0)
+		assert.NoError(t, c.OpenAOF(fname, AOFOptions{}))
+		assert.Equal(t, want, itemObjects(c.Items()))
+		assert.NoError(t, c.Close())
+	})
+
+	t.Run("Rewrite automatically once the log has grown", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.aof")
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.OpenAOF(fname, AOFOptions{RewriteMinSize: 4096}))
+		for i := 0; i < 1000; i++ {
+			c.Set("key", i, NoExpiration)
+		}
+		assert.NoError(t, c.Close())
+		data, err := os.ReadFile(fname)
+		assert.NoError(t, err)
+		assert.Equal(t, aofSnapshot, data[aofRecordHeaderSize])
+
+		c = New(DefaultExpiration, 0)
+		assert.NoError(t, c.OpenAOF(fname, AOFOptions{RewritePercentage: -1}))
+		val, _ := c.Get("key")
+		assert.Equal(t, 999, val)
+		assert.NoError(t, c.Close())
+	})
+}
+
+func fileSize(t *testing.T, fname string) int64 {
+	fi, err := os.Stat(fname)
+	assert.NoError(t, err)
+	return fi.Size()
+}
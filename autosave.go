@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// SaveRule makes the cache save itself when at least Changes changes were made
+// and Interval has passed since the last save, like "save 60 1000" in Redis.
+type SaveRule struct {
+	Interval time.Duration
+	// Changes is the number of changes needed. Values less than one mean one.
+	Changes uint64
+}
+
+// AutoSaveOptions configures NewWithAutoSave.
+type AutoSaveOptions struct {
+	// File is the file the cache is loaded from and saved to.
+	File string
+	// Rules trigger a save when any of them is met. If there are no rules, the
+	// cache is only saved by Close.
+	Rules []SaveRule
+	// Save configures how the file is saved, and Load how it is loaded.
+	Save SaveOptions
+	Load LoadOptions
+}
+
+// SaveStatus describes the automatic saves of a cache.
+type SaveStatus struct {
+	// LastSave is when the last save started, and LastDuration how long it
+	// took. LastError is the error of the last save, or nil if it succeeded.
+	LastSave     time.Time
+	LastDuration time.Duration
+	LastError    error
+	// LastSuccess is when the last successful save started, or when the cache
+	// was created if it hasn't been saved yet.
+	LastSuccess time.Time
+	// Saves and Failures count the saves and the failed saves.
+	Saves    int
+	Failures int
+	// Changes is the number of changes made since the last successful save
+	// started.
+	Changes uint64
+	// InProgress is set while a save is running.
+	InProgress bool
+}
+
+// NewWithAutoSave returns a new cache, like New, that is loaded from
+// opts.File, if it exists, and saved to it by SaveFileWithOptions whenever one
+// of opts.Rules is met. Every Set, Delete, expired item and other change
+// counts towards the rules. Close stops the automatic saves and saves the
+// cache a last time if it changed. SaveStatus reports how the saves went.
+func NewWithAutoSave(defaultExpiration, cleanupInterval time.Duration, opts AutoSaveOptions) (*Cache, error) {
+	if opts.File == "" {
+		return nil, errors.New("AutoSaveOptions.File is empty")
+	}
+	// The janitor is started once the file is loaded, so that it isn't left
+	// running if loading fails.
+	c := newCache(defaultExpiration, make(map[string]Item))
+	err := c.LoadFileWithOptions(opts.File, opts.Load)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if cleanupInterval > 0 {
+		runJanitor(c, cleanupInterval)
+	}
+	s := &autoSaver{
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	c.mu.Lock()
+	s.status.LastSuccess = time.Now()
+	s.saved = c.changes
+	c.autoSave = s
+	c.mu.Unlock()
+	go s.run(c)
+	return c, nil
+}
+
+// SaveStatus returns the status of the cache's automatic saves. It is the zero
+// value if the cache wasn't created by NewWithAutoSave.
+func (c *Cache) SaveStatus() SaveStatus {
+	c.mu.RLock()
+	s := c.autoSave
+	changes := c.changes
+	c.mu.RUnlock()
+	if s == nil {
+		return SaveStatus{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Changes = changes - s.saved
+	return status
+}
+
+// autoSaver saves a cache when one of its rules is met. The rules are checked
+// against c.changes, which counts every change made to the cache.
+type autoSaver struct {
+	opts AutoSaveOptions
+	// mu guards status and saved, the number of changes the cache had made
+	// when the last successful save started.
+	mu     sync.Mutex
+	status SaveStatus
+	saved  uint64
+	// saving serializes saves.
+	saving sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// tick returns how often the rules are checked: every second, or more often
+// if a rule has a shorter interval.
+func (s *autoSaver) tick() time.Duration {
+	tick := time.Second
+	for _, r := range s.opts.Rules {
+		if d := r.Interval / 4; d > 0 && d < tick {
+			tick = d
+		}
+	}
+	return tick
+}
+
+func (s *autoSaver) run(c *Cache) {
+	defer close(s.done)
+	if len(s.opts.Rules) == 0 {
+		<-s.stop
+		return
+	}
+	ticker := time.NewTicker(s.tick())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.due(c) {
+				s.save(c)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// due reports whether one of the rules is met.
+func (s *autoSaver) due(c *Cache) bool {
+	c.mu.RLock()
+	changes := c.changes
+	c.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Wait for an interval after a failed save, rather than retrying on
+	// every tick.
+	since := time.Since(s.status.LastSave)
+	if s.status.LastError == nil {
+		since = time.Since(s.status.LastSuccess)
+	}
+	for _, r := range s.opts.Rules {
+		if since >= r.Interval && changes-s.saved >= max(r.Changes, 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// save saves the cache to the file and records the outcome.
+func (s *autoSaver) save(c *Cache) error {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+	// Changes made between here and the start of the snapshot are counted as
+	// unsaved, which at worst causes an extra save.
+	c.mu.RLock()
+	changes := c.changes
+	c.mu.RUnlock()
+	start := time.Now()
+	s.mu.Lock()
+	s.status.InProgress = true
+	s.mu.Unlock()
+
+	err := c.SaveFileWithOptions(s.opts.File, s.opts.Save)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.InProgress = false
+	s.status.LastSave = start
+	s.status.LastDuration = time.Since(start)
+	s.status.LastError = err
+	s.status.Saves++
+	if err != nil {
+		s.status.Failures++
+		return err
+	}
+	s.status.LastSuccess = start
+	s.saved = changes
+	return nil
+}
+
+// close stops the automatic saves and saves the cache if it changed since the
+// last successful save.
+func (s *autoSaver) close(c *Cache) error {
+	close(s.stop)
+	<-s.done
+	c.mu.RLock()
+	changes := c.changes
+	c.mu.RUnlock()
+	s.mu.Lock()
+	dirty := changes != s.saved
+	s.mu.Unlock()
+	if !dirty {
+		return nil
+	}
+	return s.save(c)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithAutoSave(t *testing.T) {
+	t.Run("Save after enough changes", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.snapshot")
+		c, err := NewWithAutoSave(NoExpiration, 0, AutoSaveOptions{
+			File:  fname,
+			Rules: []SaveRule{{Interval: 20 * time.Millisecond, Changes: 3}},
+		})
+		assert.NoError(t, err)
+		c.Set("a", 1, NoExpiration)
+		c.Set("b", 2, NoExpiration)
+		time.Sleep(50 * time.Millisecond)
+		_, err = os.Stat(fname)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.Equal(t, uint64(2), c.SaveStatus().Changes)
+
+		c.Delete("a")
+		assert.Eventually(t, func() bool {
+			return c.SaveStatus().Saves == 1
+		}, time.Second, 5*time.Millisecond)
+		status := c.SaveStatus()
+		assert.NoError(t, status.LastError)
+		assert.Zero(t, status.Changes)
+		assert.Equal(t, status.LastSave, status.LastSuccess)
+		assert.False(t, status.InProgress)
+
+		loaded := New(NoExpiration, 0)
+		assert.NoError(t, loaded.LoadFile(fname))
+		assert.Equal(t, map[string]any{"b": 2}, itemObjects(loaded.Items()))
+		assert.NoError(t, c.Close())
+	})
+
+	t.Run("Load at construction and save on Close", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.snapshot")
+		c, err := NewWithAutoSave(NoExpiration, 0, AutoSaveOptions{File: fname})
+		assert.NoError(t, err)
+		c.Set("a", 1, NoExpiration)
+		assert.NoError(t, c.Close())
+		assert.Zero(t, c.SaveStatus())
+
+		c, err = NewWithAutoSave(NoExpiration, 0, AutoSaveOptions{File: fname})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"a": 1}, itemObjects(c.Items()))
+		assert.Zero(t, c.SaveStatus().Changes)
+		info, err := os.Stat(fname)
+		assert.NoError(t, err)
+		assert.NoError(t, c.Close())
+		after, err := os.Stat(fname)
+		assert.NoError(t, err)
+		assert.Equal(t, info.ModTime(), after.ModTime())
+	})
+
+	t.Run("Report failed saves", func(t *testing.T) {
+		dir := t.TempDir()
+		fname := filepath.Join(dir, "missing", "cache.snapshot")
+		c, err := NewWithAutoSave(NoExpiration, 0, AutoSaveOptions{
+			File:  fname,
+			Rules: []SaveRule{{Interval: 10 * time.Millisecond}},
+		})
+		assert.NoError(t, err)
+		c.Set("a", 1, NoExpiration)
+		assert.Eventually(t, func() bool {
+			return c.SaveStatus().Failures > 0
+		}, time.Second, 5*time.Millisecond)
+		status := c.SaveStatus()
+		assert.Error(t, status.LastError)
+		assert.True(t, status.LastSuccess.Before(status.LastSave))
+		assert.Equal(t, uint64(1), status.Changes)
+
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, "missing"), 0755))
+		assert.Eventually(t, func() bool {
+			return c.SaveStatus().LastError == nil
+		}, time.Second, 5*time.Millisecond)
+		assert.NoError(t, c.Close())
+	})
+
+	t.Run("Reject invalid files", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.snapshot")
+		assert.NoError(t, os.WriteFile(fname, []byte("GOCACHE\x00garbage"), 0644))
+		_, err := NewWithAutoSave(NoExpiration, 0, AutoSaveOptions{File: fname})
+		assert.ErrorIs(t, err, ErrInvalidSnapshot)
+		_, err = NewWithAutoSave(NoExpiration, 0, AutoSaveOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Don't start the janitor when loading fails", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.snapshot")
+		assert.NoError(t, os.WriteFile(fname, []byte("GOCACHE\x00garbage"), 0644))
+		before := runtime.NumGoroutine()
+		for i := 0; i < 10; i++ {
+			_, err := NewWithAutoSave(NoExpiration, time.Hour, AutoSaveOptions{File: fname})
+			assert.Error(t, err)
+		}
+		assert.Less(t, runtime.NumGoroutine(), before+10)
+	})
+
+	t.Run("Don't count deleting missing keys as changes", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.snapshot")
+		c, err := NewWithAutoSave(NoExpiration, 0, AutoSaveOptions{File: fname})
+		assert.NoError(t, err)
+		c.Delete("missing")
+		c.Flush()
+		assert.Zero(t, c.SaveStatus().Changes)
+
+		c.Set("a", 1, NoExpiration)
+		c.Delete("a")
+		c.Delete("a")
+		assert.Equal(t, uint64(2), c.SaveStatus().Changes)
+		c.Set("a", 1, NoExpiration)
+		c.Flush()
+		c.Flush()
+		assert.Equal(t, uint64(4), c.SaveStatus().Changes)
+		assert.NoError(t, c.Close())
+	})
+}
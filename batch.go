@@ -0,0 +1,45 @@
+package cache
+
+import "time"
+
+// GetMany gets several items from the cache, taking the lock only once. The
+// returned map contains the keys that were found and haven't expired.
+func (c *Cache) GetMany(keys []string) map[string]any {
+	m := make(map[string]any, len(keys))
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, k := range keys {
+		if x, found := c.get(k); found {
+			m[k] = x
+		}
+	}
+	return m
+}
+
+// SetMany adds several items to the cache, replacing any existing items, taking
+// the lock only once. All items get the expiration d, with the same meaning as
+// in Set.
+func (c *Cache) SetMany(items map[string]any, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, x := range items {
+		c.set(k, x, d)
+	}
+}
+
+// DeleteMany deletes several items from the cache, taking the lock only once.
+// Keys that are not in the cache are ignored.
+func (c *Cache) DeleteMany(keys []string) {
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	for _, k := range keys {
+		v, evicted := c.delete(k)
+		if evicted {
+			evictedItems = append(evictedItems, keyAndValue{k, v})
+		}
+	}
+	c.mu.Unlock()
+	for _, v := range evictedItems {
+		c.onEvicted(v.key, v.value)
+	}
+}
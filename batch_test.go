@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_GetMany(t *testing.T) {
+	t.Run("Get only found and unexpired items", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+		c.Set("key2", "value2", NoExpiration)
+		c.Set("key3", "value3", time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+
+		items := c.GetMany([]string{"key1", "key2", "key3", "key4"})
+
+		assert.Equal(t, map[string]any{"key1": "value1", "key2": "value2"}, items)
+	})
+}
+
+func TestCache_SetMany(t *testing.T) {
+	t.Run("Set several items with the same expiration", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.SetMany(map[string]any{"key1": "value1", "key2": 2}, time.Hour)
+
+		val, exp, found := c.GetWithExpiration("key1")
+		assert.True(t, found)
+		assert.Equal(t, "value1", val)
+		assert.False(t, exp.IsZero())
+
+		val, found = c.Get("key2")
+		assert.True(t, found)
+		assert.Equal(t, 2, val)
+	})
+}
+
+func TestCache_DeleteMany(t *testing.T) {
+	t.Run("Delete several items and call OnEvicted for each", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		evicted := map[string]any{}
+		c.OnEvicted(func(k string, v any) {
+			evicted[k] = v
+		})
+		c.SetMany(map[string]any{"key1": "value1", "key2": "value2", "key3": "value3"}, NoExpiration)
+
+		c.DeleteMany([]string{"key1", "key2", "missing"})
+
+		assert.Equal(t, map[string]any{"key1": "value1", "key2": "value2"}, evicted)
+		assert.Equal(t, 1, c.ItemCount())
+	})
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	// DefaultBloomCapacity is the capacity of the Bloom filters created by
+	// BFAdd when the key doesn't exist, as in RedisBloom.
+	DefaultBloomCapacity = 100
+	// DefaultBloomErrorRate is the false positive rate of the Bloom filters
+	// created by BFAdd when the key doesn't exist, as in RedisBloom.
+	DefaultBloomErrorRate = 0.01
+)
+
+// BloomFilter is the value stored by BFReserve and BFAdd. It answers whether
+// an item may have been added, with no false negatives and a false positive
+// rate close to the one it was sized for as long as it holds at most its
+// capacity.
+type BloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint32
+}
+
+func newBloomFilter(capacity uint, errorRate float64) *BloomFilter {
+	n := math.Max(float64(capacity), 1)
+	m := math.Ceil(-n * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(math.Round(m/n*math.Ln2), 1)
+	return &BloomFilter{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		m:      uint64(m),
+		hashes: uint32(k),
+	}
+}
+
+// positions calls f with the bit positions of s, using double hashing.
+func (b *BloomFilter) positions(s string, f func(pos uint64) bool) bool {
+	h1 := hash64(s)
+	h2 := fmix64(h1^0x9e3779b97f4a7c15) | 1
+	for i := uint64(0); i < uint64(b.hashes); i++ {
+		if !f((h1 + i*h2) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// add adds s, returning true if it was not already possibly in the filter.
+func (b *BloomFilter) add(s string) bool {
+	added := false
+	b.positions(s, func(pos uint64) bool {
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			b.bits[pos/64] |= 1 << (pos % 64)
+			added = true
+		}
+		return true
+	})
+	return added
+}
+
+func (b *BloomFilter) exists(s string) bool {
+	return b.positions(s, func(pos uint64) bool {
+		return b.bits[pos/64]&(1<<(pos%64)) != 0
+	})
+}
+
+// GobEncode encodes the size, number of hashes and bits of the filter.
+func (b *BloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, b.m)
+	binary.Write(&buf, binary.BigEndian, b.hashes)
+	binary.Write(&buf, binary.BigEndian, b.bits)
+	return buf.Bytes(), nil
+}
+
+// maxBloomHashes bounds the number of hashes of a decoded filter. It is more
+// than the filter for the smallest positive float64 error rate uses.
+const maxBloomHashes = 2048
+
+// maxBloomBits bounds the size of a decoded filter, so that its number of
+// words can be computed without overflowing.
+const maxBloomBits = math.MaxUint64 - 63
+
+// GobDecode decodes a filter encoded by GobEncode.
+func (b *BloomFilter) GobDecode(data []byte) error {
+	r := bytes.NewReader(data)
+	var m uint64
+	var hashes uint32
+	if err := binary.Read(r, binary.BigEndian, &m); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &hashes); err != nil {
+		return err
+	}
+	if m == 0 || m > maxBloomBits || hashes == 0 || hashes > maxBloomHashes {
+		return fmt.Errorf("Invalid Bloom filter of %d bits with %d hashes", m, hashes)
+	}
+	words := (m + 63) / 64
+	if uint64(r.Len()) != words*8 {
+		return fmt.Errorf("Invalid Bloom filter of %d bits with %d bytes of data", m, r.Len())
+	}
+	bits := make([]uint64, words)
+	if err := binary.Read(r, binary.BigEndian, bits); err != nil {
+		return err
+	}
+	b.bits, b.m, b.hashes = bits, m, hashes
+	return nil
+}
+
+// BFReserve creates an empty Bloom filter under k, sized to hold capacity
+// items with the given false positive rate, e.g. 0.01 for 1%. Returns an error
+// if an item already exists for the given key.
+func (c *Cache) BFReserve(k string, capacity uint, errorRate float64) error {
+	if errorRate <= 0 || errorRate >= 1 {
+		return fmt.Errorf("Invalid Bloom filter error rate %v", errorRate)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, found := c.get(k); found {
+		return fmt.Errorf("Item %s already exists", k)
+	}
+	c.set(k, newBloomFilter(capacity, errorRate), DefaultExpiration)
+	return nil
+}
+
+// BFAdd adds item to the Bloom filter stored under k, creating one with
+// DefaultBloomCapacity and DefaultBloomErrorRate if the key doesn't exist.
+// Returns true if the item was not already possibly in the filter.
+func (c *Cache) BFAdd(k string, item string) (bool, error) {
+	var added bool
+	err := updateValue(c, k, func() *BloomFilter {
+		return newBloomFilter(DefaultBloomCapacity, DefaultBloomErrorRate)
+	}, func(b *BloomFilter) bool {
+		added = b.add(item)
+		return true
+	})
+	return added, err
+}
+
+// BFExists reports whether item may have been added to the Bloom filter
+// stored under k. False means it definitely wasn't.
+func (c *Cache) BFExists(k string, item string) (bool, error) {
+	var exists bool
+	err := readValue(c, k, func(b *BloomFilter, found bool) {
+		exists = found && b.exists(item)
+	})
+	return exists, err
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_BFReserve(t *testing.T) {
+	t.Run("Reserve a filter with a given size", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.BFReserve("seen", 10000, 0.001))
+
+		val, _ := c.Get("seen")
+		b := val.(*BloomFilter)
+		assert.Equal(t, uint64(143776), b.m)
+		assert.Equal(t, uint32(10), b.hashes)
+	})
+
+	t.Run("Reserve an existing key", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.BFAdd("seen", "a")
+		assert.Error(t, c.BFReserve("seen", 100, 0.01))
+	})
+
+	t.Run("Reserve with an invalid error rate", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		assert.Error(t, c.BFReserve("seen", 100, 0))
+		assert.Error(t, c.BFReserve("seen", 100, 1))
+	})
+}
+
+func TestCache_BFAdd(t *testing.T) {
+	t.Run("Add items and check membership", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		added, err := c.BFAdd("seen", "a")
+		assert.NoError(t, err)
+		assert.True(t, added)
+
+		added, _ = c.BFAdd("seen", "a")
+		assert.False(t, added)
+
+		exists, err := c.BFExists("seen", "a")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, _ = c.BFExists("missing", "a")
+		assert.False(t, exists)
+	})
+
+	t.Run("Keep the false positive rate near the target", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.BFReserve("seen", 10000, 0.01))
+		for i := 0; i < 10000; i++ {
+			_, _ = c.BFAdd("seen", fmt.Sprintf("in-%d", i))
+		}
+		falsePositives := 0
+		for i := 0; i < 10000; i++ {
+			if exists, _ := c.BFExists("seen", fmt.Sprintf("out-%d", i)); exists {
+				falsePositives++
+			}
+		}
+		assert.Less(t, falsePositives, 200)
+	})
+
+	t.Run("Filters expire like other items", func(t *testing.T) {
+		c := New(10*time.Millisecond, 0)
+		_, _ = c.BFAdd("seen", "a")
+		time.Sleep(20 * time.Millisecond)
+
+		exists, _ := c.BFExists("seen", "a")
+		assert.False(t, exists)
+	})
+}
+
+func TestBloomFilter_Gob(t *testing.T) {
+	t.Run("Save and load a Bloom filter", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.BFAdd("seen", "a")
+		var buf bytes.Buffer
+		assert.NoError(t, c.Save(&buf))
+
+		c2 := New(DefaultExpiration, 0)
+		assert.NoError(t, c2.Load(&buf))
+
+		exists, err := c2.BFExists("seen", "a")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	})
+	t.Run("Reject a corrupt Bloom filter", func(t *testing.T) {
+		valid, _ := newBloomFilter(10, 0.01).GobEncode()
+		encode := func(m uint64, hashes uint32, words int) []byte {
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.BigEndian, m)
+			binary.Write(&buf, binary.BigEndian, hashes)
+			binary.Write(&buf, binary.BigEndian, make([]uint64, words))
+			return buf.Bytes()
+		}
+		for name, data := range map[string][]byte{
+			"no bits":         encode(0, 3, 0),
+			"no hashes":       encode(64, 0, 1),
+			"too many hashes": encode(64, 1<<20, 1),
+			"short bits":      encode(128, 3, 1),
+			"too many bits":   encode(math.MaxUint64, 3, 0),
+			"wrapped words":   encode(math.MaxUint64-62, 3, 0),
+			"truncated":       valid[:len(valid)-1],
+		} {
+			var b BloomFilter
+			assert.Error(t, b.GobDecode(data), name)
+		}
+	})
+}
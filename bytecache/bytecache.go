@@ -0,0 +1,217 @@
+// Package bytecache provides a cache of []byte values for very large numbers
+// of entries, modeled on bigcache and freecache. Entries are copied into large
+// preallocated ring buffers, one per shard, and found through maps from key
+// hashes to offsets. Neither the buffers nor the maps contain pointers, so the
+// garbage collector doesn't scan them, however many entries there are.
+//
+// When a shard's buffer is full, the oldest entries are overwritten, whether
+// or not they have expired. Two keys with the same 64-bit hash can't be stored
+// at the same time: storing one removes the other.
+package bytecache
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/pzentenoe/go-cache"
+)
+
+const (
+	defaultShards   = 64
+	defaultCapacity = 64 << 20
+	maxShardBytes   = 1<<32 - 1
+)
+
+var (
+	// ErrEntryTooLarge is returned by Set when the entry doesn't fit in a
+	// shard's buffer.
+	ErrEntryTooLarge = errors.New("Entry is larger than a shard's buffer")
+	// ErrKeyTooLarge is returned by Set for keys longer than 65535 bytes.
+	ErrKeyTooLarge = errors.New("Key is longer than 65535 bytes")
+	// ErrClosed is returned by Set after Close.
+	ErrClosed = errors.New("Cache is closed")
+)
+
+// Options configures a Cache.
+type Options struct {
+	// Shards is the number of shards, each with its own lock and buffer. It
+	// is rounded up to a power of two. Defaults to 64.
+	Shards int
+	// Capacity is the total size of the buffers in bytes, split evenly between
+	// the shards. Every entry takes 24 bytes on top of its key and value.
+	// Defaults to 64 MiB.
+	Capacity int
+	// DefaultExpiration has the same meaning as in cache.New.
+	DefaultExpiration time.Duration
+	// OffHeap allocates the buffers with mmap outside the Go heap, on the
+	// platforms that support it, so that they don't count towards GOGC and
+	// are returned to the operating system by Close. It is ignored elsewhere.
+	OffHeap bool
+}
+
+// Cache is a cache of []byte values. It is safe for concurrent use.
+type Cache struct {
+	shards            []*shard
+	mask              uint64
+	defaultExpiration time.Duration
+	offHeap           bool
+	closed            atomic.Bool
+}
+
+// Stats counts the lookups and evictions of a Cache.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Evictions counts the unexpired entries overwritten because a buffer was
+	// full.
+	Evictions uint64
+	// Collisions counts the lookups that found an entry with the same hash
+	// but a different key.
+	Collisions uint64
+}
+
+// New returns a Cache with the buffers allocated up front.
+func New(opts Options) (*Cache, error) {
+	if opts.Shards <= 0 {
+		opts.Shards = defaultShards
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = defaultCapacity
+	}
+	if opts.DefaultExpiration == cache.DefaultExpiration {
+		opts.DefaultExpiration = cache.NoExpiration
+	}
+	n := 1
+	for n < opts.Shards {
+		n <<= 1
+	}
+	size := opts.Capacity / n
+	if size < headerSize {
+		return nil, errors.New("Capacity is too small for the number of shards")
+	}
+	if size > maxShardBytes {
+		return nil, errors.New("Capacity is too large for the number of shards")
+	}
+	c := &Cache{
+		shards:            make([]*shard, n),
+		mask:              uint64(n - 1),
+		defaultExpiration: opts.DefaultExpiration,
+		offHeap:           opts.OffHeap && offHeapSupported,
+	}
+	for i := range c.shards {
+		buf, err := allocate(size, c.offHeap)
+		if err != nil {
+			c.release()
+			return nil, err
+		}
+		c.shards[i] = newShard(buf)
+	}
+	return c, nil
+}
+
+func (c *Cache) shard(h uint64) *shard {
+	// The low bits select the shard, so use the high bits, which are as well
+	// mixed.
+	return c.shards[(h>>32)&c.mask]
+}
+
+// Set stores a copy of v under k, replacing any existing entry, with the same
+// meaning for d as in cache.Cache.Set.
+func (c *Cache) Set(k string, v []byte, d time.Duration) error {
+	if len(k) > maxKeyLen {
+		return ErrKeyTooLarge
+	}
+	if d == cache.DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	now := time.Now().UnixNano()
+	var expiration int64
+	if d > 0 {
+		expiration = now + int64(d)
+	}
+	h := hash(k)
+	return c.shard(h).set(h, k, v, expiration, now)
+}
+
+// Get returns a copy of the value stored under k, and whether it was found and
+// hasn't expired.
+func (c *Cache) Get(k string) ([]byte, bool) {
+	return c.Append(nil, k)
+}
+
+// Append appends the value stored under k to dst, like Get, and returns the
+// extended slice, so that a buffer can be reused across lookups.
+func (c *Cache) Append(dst []byte, k string) ([]byte, bool) {
+	h := hash(k)
+	return c.shard(h).get(dst, h, k, time.Now().UnixNano())
+}
+
+// Delete removes the entry stored under k, and reports whether there was one.
+func (c *Cache) Delete(k string) bool {
+	h := hash(k)
+	return c.shard(h).delete(h, k)
+}
+
+// DeleteExpired removes all expired entries from the index, so that Len no
+// longer counts them. Their space is reused when the buffers wrap around.
+func (c *Cache) DeleteExpired() {
+	now := time.Now().UnixNano()
+	for _, s := range c.shards {
+		s.deleteExpired(now)
+	}
+}
+
+// Len returns the number of entries, including those that expired but haven't
+// been removed by DeleteExpired or overwritten yet.
+func (c *Cache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.len()
+	}
+	return n
+}
+
+// Stats returns the cache's counters.
+func (c *Cache) Stats() Stats {
+	var st Stats
+	for _, s := range c.shards {
+		st.Hits += s.hits.Load()
+		st.Misses += s.misses.Load()
+		st.Evictions += s.evictions.Load()
+		st.Collisions += s.collisions.Load()
+	}
+	return st
+}
+
+// Close releases the buffers. After Close, Set returns ErrClosed and Get finds
+// nothing.
+func (c *Cache) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	return c.release()
+}
+
+func (c *Cache) release() error {
+	var errs []error
+	for _, s := range c.shards {
+		if s == nil {
+			continue
+		}
+		if buf := s.close(); buf != nil {
+			errs = append(errs, free(buf, c.offHeap))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hash is 64-bit FNV-1a, inlined to avoid allocating a hash.Hash64.
+func hash(k string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(k); i++ {
+		h ^= uint64(k[i])
+		h *= 1099511628211
+	}
+	return h
+}
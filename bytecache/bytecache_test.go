@@ -0,0 +1,156 @@
+package bytecache
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pzentenoe/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCache(t *testing.T, opts Options) *Cache {
+	t.Helper()
+	c, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestCache(t *testing.T) {
+	t.Run("Set, get and delete entries", func(t *testing.T) {
+		c := newCache(t, Options{})
+		assert.NoError(t, c.Set("a", []byte("one"), cache.NoExpiration))
+		assert.NoError(t, c.Set("b", []byte("two"), cache.DefaultExpiration))
+		assert.NoError(t, c.Set("a", []byte("three"), cache.DefaultExpiration))
+
+		v, found := c.Get("a")
+		assert.True(t, found)
+		assert.Equal(t, []byte("three"), v)
+		v[0] = 'x'
+		v, _ = c.Get("a")
+		assert.Equal(t, []byte("three"), v)
+		buf, found := c.Append([]byte("b="), "b")
+		assert.True(t, found)
+		assert.Equal(t, []byte("b=two"), buf)
+		assert.Equal(t, 2, c.Len())
+
+		assert.True(t, c.Delete("a"))
+		assert.False(t, c.Delete("a"))
+		_, found = c.Get("a")
+		assert.False(t, found)
+		assert.Equal(t, 1, c.Len())
+		assert.Equal(t, Stats{Hits: 3, Misses: 1}, c.Stats())
+	})
+
+	t.Run("Expire entries", func(t *testing.T) {
+		c := newCache(t, Options{DefaultExpiration: 10 * time.Millisecond})
+		assert.NoError(t, c.Set("short", []byte("1"), cache.DefaultExpiration))
+		assert.NoError(t, c.Set("long", []byte("2"), time.Hour))
+		time.Sleep(20 * time.Millisecond)
+
+		_, found := c.Get("short")
+		assert.False(t, found)
+		_, found = c.Get("long")
+		assert.True(t, found)
+		assert.Equal(t, 2, c.Len())
+		c.DeleteExpired()
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("Overwrite the oldest entries when full", func(t *testing.T) {
+		c := newCache(t, Options{Shards: 4, Capacity: 64 << 10})
+		value := bytes.Repeat([]byte("v"), 100)
+		for i := 0; i < 10000; i++ {
+			assert.NoError(t, c.Set(fmt.Sprintf("key%d", i), value, cache.NoExpiration))
+		}
+		assert.Less(t, c.Len(), 64<<10/100)
+		assert.Greater(t, c.Stats().Evictions, uint64(0))
+		_, found := c.Get("key0")
+		assert.False(t, found)
+		v, found := c.Get("key9999")
+		assert.True(t, found)
+		assert.Equal(t, value, v)
+	})
+
+	t.Run("Reject entries that don't fit", func(t *testing.T) {
+		c := newCache(t, Options{Shards: 1, Capacity: 1024})
+		assert.ErrorIs(t, c.Set("a", make([]byte, 1024), cache.NoExpiration), ErrEntryTooLarge)
+		assert.ErrorIs(t, c.Set(string(make([]byte, 1<<16)), nil, cache.NoExpiration), ErrKeyTooLarge)
+		assert.NoError(t, c.Set("a", make([]byte, 1024-headerSize-1), cache.NoExpiration))
+		_, err := New(Options{Shards: 64, Capacity: 64})
+		assert.Error(t, err)
+	})
+
+	t.Run("Allocate buffers off the heap", func(t *testing.T) {
+		c, err := New(Options{Shards: 2, Capacity: 1 << 20, OffHeap: true})
+		assert.NoError(t, err)
+		assert.Equal(t, offHeapSupported, c.offHeap)
+		assert.NoError(t, c.Set("a", []byte("one"), cache.NoExpiration))
+		v, _ := c.Get("a")
+		assert.Equal(t, []byte("one"), v)
+
+		assert.NoError(t, c.Close())
+		assert.NoError(t, c.Close())
+		_, found := c.Get("a")
+		assert.False(t, found)
+		assert.ErrorIs(t, c.Set("a", []byte("one"), cache.NoExpiration), ErrClosed)
+		assert.Zero(t, c.Len())
+	})
+
+	t.Run("Concurrent use", func(t *testing.T) {
+		c := newCache(t, Options{Shards: 4, Capacity: 256 << 10})
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 2000; i++ {
+					k := fmt.Sprintf("key%d", i%500)
+					c.Set(k, []byte(k), cache.NoExpiration)
+					if v, found := c.Get(k); found {
+						assert.Equal(t, k, string(v))
+					}
+					if i%7 == g {
+						c.Delete(k)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+	})
+}
+
+func TestShard(t *testing.T) {
+	t.Run("Wrap around the buffer", func(t *testing.T) {
+		// Each entry takes 35 of the 100 bytes.
+		s := newShard(make([]byte, 100))
+		value := bytes.Repeat([]byte("v"), 10)
+		for i, k := range []string{"a", "b", "c", "d"} {
+			assert.NoError(t, s.set(uint64(i), k, value, 0, 0))
+		}
+		for i, k := range []string{"a", "b", "c", "d"} {
+			_, found := s.get(nil, uint64(i), k, 0)
+			assert.Equal(t, i >= 2, found, k)
+		}
+		assert.Equal(t, 2, s.len())
+		assert.Equal(t, uint64(2), s.evictions.Load())
+	})
+
+	t.Run("Keys with the same hash replace each other", func(t *testing.T) {
+		s := newShard(make([]byte, 100))
+		assert.NoError(t, s.set(1, "a", []byte("1"), 0, 0))
+		assert.NoError(t, s.set(1, "b", []byte("2"), 0, 0))
+		_, found := s.get(nil, 1, "a", 0)
+		assert.False(t, found)
+		assert.Equal(t, uint64(1), s.collisions.Load())
+		v, _ := s.get(nil, 1, "b", 0)
+		assert.Equal(t, []byte("2"), v)
+		assert.False(t, s.delete(1, "a"))
+		assert.Equal(t, 1, s.len())
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd
+
+package bytecache
+
+const offHeapSupported = false
+
+// allocate returns a zeroed buffer of size bytes. Buffers are always on the
+// Go heap on this platform.
+func allocate(size int, offHeap bool) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+// free releases a buffer returned by allocate.
+func free(buf []byte, offHeap bool) error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package bytecache
+
+import "syscall"
+
+const offHeapSupported = true
+
+// allocate returns a zeroed buffer of size bytes, mapped outside the Go heap
+// if offHeap is set.
+func allocate(size int, offHeap bool) ([]byte, error) {
+	if !offHeap {
+		return make([]byte, size), nil
+	}
+	return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+// free releases a buffer returned by allocate.
+func free(buf []byte, offHeap bool) error {
+	if !offHeap {
+		return nil
+	}
+	return syscall.Munmap(buf)
+}
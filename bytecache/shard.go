@@ -0,0 +1,174 @@
+package bytecache
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+)
+
+// An entry is a header followed by the key and the value. The header holds, in
+// little-endian order, the uint64 hash of the key, the int64 expiration time
+// in Unix nanoseconds or 0, the uint16 key length, two unused bytes and the
+// uint32 value length. An entry is live as long as the index points to it.
+const (
+	headerSize = 24
+	maxKeyLen  = 1<<16 - 1
+)
+
+// shard is a ring buffer of entries. The entries are stored from head to
+// tail. Once the buffer wraps around, they are stored from head to end and
+// from the start of the buffer to tail, and the oldest entries, at head, are
+// overwritten to make room for new ones.
+type shard struct {
+	mu      sync.RWMutex
+	index   map[uint64]uint32
+	buf     []byte
+	head    uint32
+	tail    uint32
+	end     uint32
+	wrapped bool
+
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	evictions  atomic.Uint64
+	collisions atomic.Uint64
+}
+
+func newShard(buf []byte) *shard {
+	return &shard{index: make(map[uint64]uint32), buf: buf}
+}
+
+func (s *shard) set(h uint64, k string, v []byte, expiration, now int64) error {
+	n := headerSize + len(k) + len(v)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buf == nil {
+		return ErrClosed
+	}
+	if n > len(s.buf) {
+		return ErrEntryTooLarge
+	}
+	delete(s.index, h)
+	off := s.alloc(uint32(n), now)
+	e := s.buf[off : off+uint32(n)]
+	binary.LittleEndian.PutUint64(e[0:], h)
+	binary.LittleEndian.PutUint64(e[8:], uint64(expiration))
+	binary.LittleEndian.PutUint16(e[16:], uint16(len(k)))
+	binary.LittleEndian.PutUint16(e[18:], 0)
+	binary.LittleEndian.PutUint32(e[20:], uint32(len(v)))
+	copy(e[headerSize:], k)
+	copy(e[headerSize+len(k):], v)
+	s.index[h] = off
+	return nil
+}
+
+// alloc returns the offset of n free bytes, overwriting the oldest entries if
+// needed. n must not be larger than the buffer. The caller must hold s.mu.
+func (s *shard) alloc(n uint32, now int64) uint32 {
+	for {
+		if !s.wrapped {
+			if s.head == s.tail {
+				s.head, s.tail = 0, 0
+			}
+			if uint32(len(s.buf))-s.tail >= n {
+				break
+			}
+			s.end, s.tail, s.wrapped = s.tail, 0, true
+			continue
+		}
+		if s.head-s.tail >= n {
+			break
+		}
+		s.evict(now)
+	}
+	off := s.tail
+	s.tail += n
+	return off
+}
+
+// evict removes the oldest entry. The caller must hold s.mu.
+func (s *shard) evict(now int64) {
+	off := s.head
+	e := s.buf[off:]
+	h := binary.LittleEndian.Uint64(e[0:])
+	if idx, found := s.index[h]; found && idx == off {
+		delete(s.index, h)
+		expiration := int64(binary.LittleEndian.Uint64(e[8:]))
+		if expiration == 0 || expiration > now {
+			s.evictions.Add(1)
+		}
+	}
+	s.head += entrySize(e)
+	if s.head == s.end {
+		s.head, s.wrapped = 0, false
+	}
+}
+
+func (s *shard) get(dst []byte, h uint64, k string, now int64) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	off, found := s.index[h]
+	if !found {
+		s.misses.Add(1)
+		return dst, false
+	}
+	e := s.buf[off:]
+	if !hasKey(e, k) {
+		s.collisions.Add(1)
+		s.misses.Add(1)
+		return dst, false
+	}
+	if expiration := int64(binary.LittleEndian.Uint64(e[8:])); expiration > 0 && now > expiration {
+		s.misses.Add(1)
+		return dst, false
+	}
+	s.hits.Add(1)
+	start := headerSize + len(k)
+	return append(dst, e[start:start+int(binary.LittleEndian.Uint32(e[20:]))]...), true
+}
+
+func (s *shard) delete(h uint64, k string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	off, found := s.index[h]
+	if !found || !hasKey(s.buf[off:], k) {
+		return false
+	}
+	delete(s.index, h)
+	return true
+}
+
+func (s *shard) deleteExpired(now int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, off := range s.index {
+		if expiration := int64(binary.LittleEndian.Uint64(s.buf[off+8:])); expiration > 0 && now > expiration {
+			delete(s.index, h)
+		}
+	}
+}
+
+func (s *shard) len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index)
+}
+
+// close empties the shard and returns its buffer.
+func (s *shard) close() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buf := s.buf
+	s.buf = nil
+	s.index = make(map[uint64]uint32)
+	return buf
+}
+
+func hasKey(e []byte, k string) bool {
+	n := int(binary.LittleEndian.Uint16(e[16:]))
+	return n == len(k) && string(e[headerSize:headerSize+n]) == k
+}
+
+func entrySize(e []byte) uint32 {
+	return headerSize + uint32(binary.LittleEndian.Uint16(e[16:])) + binary.LittleEndian.Uint32(e[20:])
+}
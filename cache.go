@@ -22,41 +22,69 @@ type Cache struct {
 	mu                sync.RWMutex
 	onEvicted         func(string, any)
 	janitor           *janitor
+	version           uint64
+	overflow          OverflowPolicy
+	loader            Loader
+	negativeTTL       time.Duration
+	store             *storeSync
+	saveMu            sync.Mutex
+	snapshot          *snapshotWriter
+	snapshotGen       uint64
+	aof               *appendLog
+	changes           uint64
+	autoSave          *autoSaver
 }
 
 // Set Add an item to the cache, replacing any existing item. If the duration is 0
 // (DefaultExpiration), the cache's default expiration time is used. If it is -1
 // (NoExpiration), the item never expires.
 func (c *Cache) Set(k string, x any, d time.Duration) {
-	var e int64
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
-	}
-	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
-	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.items[k] = Item{
-		Object:     x,
-		Expiration: e,
-	}
+	c.set(k, x, d)
 }
 
 func (c *Cache) set(k string, x any, d time.Duration) {
-	var e int64
+	c.write(k, Item{
+		Object:     x,
+		Expiration: c.expiration(d),
+	})
+}
+
+// expiration returns the expiration timestamp for an item stored now with the
+// duration d.
+func (c *Cache) expiration(d time.Duration) int64 {
 	if d == DefaultExpiration {
 		d = c.defaultExpiration
 	}
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		return time.Now().Add(d).UnixNano()
 	}
-	c.items[k] = Item{
-		Object:     x,
-		Expiration: e,
+	return 0
+}
+
+// write stores item under k and passes the change on to the cache's store, if
+// any. Every modification of c.items other than a deletion goes through write.
+func (c *Cache) write(k string, item Item) {
+	c.put(k, item)
+	c.changes++
+	if c.store != nil {
+		c.store.written(k, item)
+	}
+	if c.aof != nil {
+		c.aof.written(k, item)
 	}
 }
 
+// put stores item under k, stamping it with the next version number, without
+// involving the cache's store.
+func (c *Cache) put(k string, item Item) {
+	c.preserve(k)
+	c.version++
+	item.version = c.version
+	c.items[k] = item
+}
+
 // SetDefault Add an item to the cache, replacing any existing item, using the default
 // expiration.
 func (c *Cache) SetDefault(k string, x any) {
@@ -94,11 +122,7 @@ func (c *Cache) Replace(k string, x any, d time.Duration) error {
 func (c *Cache) Get(k string) (any, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	item, found := c.items[k]
-	if !found || item.Expired() {
-		return nil, false
-	}
-	return item.Object, true
+	return c.get(k)
 }
 
 // GetWithExpiration returns an item and its expiration time from the cache.
@@ -109,15 +133,12 @@ func (c *Cache) GetWithExpiration(k string) (any, time.Time, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	item, found := c.items[k]
+	item, found := c.lookup(k)
 	if !found {
 		return nil, time.Time{}, false
 	}
 
 	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			return nil, time.Time{}, false
-		}
 		return item.Object, time.Unix(0, item.Expiration), true
 	}
 
@@ -125,14 +146,64 @@ func (c *Cache) GetWithExpiration(k string) (any, time.Time, bool) {
 	return item.Object, time.Time{}, true
 }
 
+// GetAndDelete atomically gets an item from the cache and deletes it. Returns
+// the item or nil, and a bool indicating whether the key was found. The
+// OnEvicted function is called as it is by Delete.
+func (c *Cache) GetAndDelete(k string) (any, bool) {
+	c.mu.Lock()
+	x, found := c.get(k)
+	v, evicted := c.delete(k)
+	c.mu.Unlock()
+	if evicted {
+		c.onEvicted(k, v)
+	}
+	return x, found
+}
+
+// GetAndSet atomically sets a new value for the cache key and returns the
+// previous one. Returns the old item or nil, and a bool indicating whether the
+// key was found. As with Set, overwriting an item does not call the OnEvicted
+// function.
+func (c *Cache) GetAndSet(k string, x any, d time.Duration) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, found := c.get(k)
+	c.set(k, x, d)
+	return old, found
+}
+
+// GetEx gets an item from the cache and resets its expiration time to d, using
+// the same rules as Set. Returns the item or nil, and a bool indicating whether
+// the key was found.
+func (c *Cache) GetEx(k string, d time.Duration) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	x, found := c.get(k)
+	if !found {
+		return nil, false
+	}
+	c.set(k, x, d)
+	return x, true
+}
+
 func (c *Cache) get(k string) (any, bool) {
-	item, found := c.items[k]
-	if !found || item.Expired() {
+	item, found := c.lookup(k)
+	if !found {
 		return nil, false
 	}
 	return item.Object, true
 }
 
+// lookup returns the item stored under k if it exists, hasn't expired and is
+// not a tombstone left by GetOrLoad.
+func (c *Cache) lookup(k string) (Item, bool) {
+	item, found := c.items[k]
+	if !found || item.Expired() || item.tombstone() {
+		return Item{}, false
+	}
+	return item, true
+}
+
 // Delete an item from the cache. Does nothing if the key is not in the cache.
 func (c *Cache) Delete(k string) {
 	c.mu.Lock()
@@ -144,8 +215,23 @@ func (c *Cache) Delete(k string) {
 }
 
 func (c *Cache) delete(k string) (any, bool) {
+	if item, found := c.items[k]; found && !item.tombstone() {
+		c.changes++
+	}
+	if c.store != nil {
+		c.store.deleted(k)
+	}
+	if c.aof != nil {
+		c.aof.deleted(k)
+	}
+	return c.remove(k)
+}
+
+// remove deletes k without involving the cache's store. See delete.
+func (c *Cache) remove(k string) (any, bool) {
+	c.preserve(k)
 	if c.onEvicted != nil {
-		if v, found := c.items[k]; found {
+		if v, found := c.items[k]; found && !v.tombstone() {
 			delete(c.items, k)
 			return v.Object, true
 		}
@@ -165,7 +251,11 @@ func (c *Cache) DeleteExpired() {
 	c.mu.Lock()
 	for k, v := range c.items {
 		if v.Expired() {
-			ov, evicted := c.delete(k)
+			c.changes++
+			if c.aof != nil {
+				c.aof.deleted(k)
+			}
+			ov, evicted := c.remove(k)
 			if evicted {
 				evictedItems = append(evictedItems, keyAndValue{k, ov})
 			}
@@ -190,5 +280,11 @@ func (c *Cache) OnEvicted(f func(string, any)) {
 func (c *Cache) Flush() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if len(c.items) > 0 {
+		c.changes++
+	}
+	if c.aof != nil {
+		c.aof.flushed()
+	}
 	c.items = make(map[string]Item)
 }
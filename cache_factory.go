@@ -8,10 +8,14 @@ func newCache(de time.Duration, m map[string]Item) *Cache {
 	if de == 0 {
 		de = DefaultExpiration
 	}
-	return &Cache{
+	c := &Cache{
 		defaultExpiration: de,
 		items:             m,
 	}
+	for k, v := range m {
+		c.write(k, v)
+	}
+	return c
 }
 
 func newCacheWithJanitor(de, ci time.Duration, m map[string]Item) *Cache {
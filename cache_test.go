@@ -188,6 +188,86 @@ func TestCache_GetWithExpiration(t *testing.T) {
 	})
 }
 
+func TestCache_GetAndDelete(t *testing.T) {
+	cache := New(DefaultExpiration, 0)
+
+	t.Run("GetAndDelete non-existing item", func(t *testing.T) {
+		_, found := cache.GetAndDelete("key1")
+		if found {
+			t.Error("Expected not to find a non-existing item, but found one")
+		}
+	})
+
+	t.Run("GetAndDelete existing item", func(t *testing.T) {
+		var evicted any
+		cache.OnEvicted(func(k string, v any) {
+			evicted = v
+		})
+		defer cache.OnEvicted(nil)
+		cache.Set("key2", "value2", DefaultExpiration)
+		v, found := cache.GetAndDelete("key2")
+		if !found || v != "value2" {
+			t.Errorf("Expected to find key2 with value 'value2', got %v", v)
+		}
+		if _, found := cache.Get("key2"); found {
+			t.Error("Expected not to find the deleted item, but found one")
+		}
+		if evicted != "value2" {
+			t.Errorf("Expected OnEvicted to be called with 'value2', got %v", evicted)
+		}
+	})
+}
+
+func TestCache_GetAndSet(t *testing.T) {
+	cache := New(DefaultExpiration, 0)
+
+	t.Run("GetAndSet non-existing item", func(t *testing.T) {
+		_, found := cache.GetAndSet("key1", "value1", DefaultExpiration)
+		if found {
+			t.Error("Expected not to find a non-existing item, but found one")
+		}
+		if v, found := cache.Get("key1"); !found || v != "value1" {
+			t.Errorf("Expected to find key1 with value 'value1', got %v", v)
+		}
+	})
+
+	t.Run("GetAndSet existing item", func(t *testing.T) {
+		v, found := cache.GetAndSet("key1", "newValue1", DefaultExpiration)
+		if !found || v != "value1" {
+			t.Errorf("Expected old value 'value1', got %v", v)
+		}
+		if v, found := cache.Get("key1"); !found || v != "newValue1" {
+			t.Errorf("Expected to find key1 with value 'newValue1', got %v", v)
+		}
+	})
+}
+
+func TestCache_GetEx(t *testing.T) {
+	cache := New(DefaultExpiration, 0)
+
+	t.Run("GetEx non-existing item", func(t *testing.T) {
+		_, found := cache.GetEx("key1", time.Minute)
+		if found {
+			t.Error("Expected not to find a non-existing item, but found one")
+		}
+		if _, found := cache.Get("key1"); found {
+			t.Error("Expected GetEx not to create the item")
+		}
+	})
+
+	t.Run("GetEx resets the expiration", func(t *testing.T) {
+		cache.Set("key2", "value2", 100*time.Millisecond)
+		v, found := cache.GetEx("key2", NoExpiration)
+		if !found || v != "value2" {
+			t.Errorf("Expected to find key2 with value 'value2', got %v", v)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if _, exp, found := cache.GetWithExpiration("key2"); !found || !exp.IsZero() {
+			t.Errorf("Expected key2 to no longer expire, got %v", exp)
+		}
+	})
+}
+
 func TestCache_Delete(t *testing.T) {
 	cache := New(DefaultExpiration, 0)
 
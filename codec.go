@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"encoding"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Codec encodes the items of a snapshot written by SaveWith and decodes them
+// in LoadWith. The codec's name is stored in the snapshot header, and LoadWith
+// refuses snapshots written with another codec.
+type Codec interface {
+	Name() string
+	// NewEncoder returns an encoder writing items to w.
+	NewEncoder(w io.Writer) ItemEncoder
+	// NewDecoder returns a decoder reading items written by an encoder from
+	// this codec from r. Every call to Decode reads what one call to Encode
+	// wrote.
+	NewDecoder(r io.Reader) ItemDecoder
+}
+
+// ItemEncoder writes items for a Codec.
+type ItemEncoder interface {
+	Encode(k string, item Item) error
+}
+
+// ItemDecoder reads items for a Codec.
+type ItemDecoder interface {
+	Decode() (k string, item Item, err error)
+}
+
+// GobCodec encodes items with Gob, which is what Save and Load use. Every type
+// stored in the cache must be registered with gob.Register before loading.
+var GobCodec Codec = gobCodec{}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) NewEncoder(w io.Writer) ItemEncoder {
+	return gobEncoder{gob.NewEncoder(w)}
+}
+
+func (gobCodec) NewDecoder(r io.Reader) ItemDecoder {
+	return gobDecoder{gob.NewDecoder(r)}
+}
+
+type gobEncoder struct {
+	enc *gob.Encoder
+}
+
+func (e gobEncoder) Encode(k string, item Item) error {
+	if item.Object != nil {
+		gob.Register(item.Object)
+	}
+	return e.enc.Encode(&snapshotRecord{Key: k, Item: item})
+}
+
+type gobDecoder struct {
+	dec *gob.Decoder
+}
+
+func (d gobDecoder) Decode() (string, Item, error) {
+	var rec snapshotRecord
+	err := d.dec.Decode(&rec)
+	return rec.Key, rec.Item, err
+}
+
+// TypeRegistry names the types of the values stored in the cache, so that the
+// JSON, MessagePack and CBOR codecs can decode them back into the same types.
+// Values of types that aren't registered are still encoded, but are decoded as
+// generic values, e.g. a struct as a map[string]any. The basic types, the
+// collection types used by the cache commands, time.Time and time.Duration
+// are registered by NewTypeRegistry.
+type TypeRegistry struct {
+	mu     sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}
+
+// NewTypeRegistry returns a registry with the built-in types registered.
+func NewTypeRegistry() *TypeRegistry {
+	r := &TypeRegistry{
+		byName: make(map[string]reflect.Type),
+		byType: make(map[reflect.Type]string),
+	}
+	for _, v := range []any{
+		false, "", []byte(nil),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0),
+		[]any(nil), map[string]any(nil), []string(nil), map[string]string(nil),
+		StringSet(nil), (*SortedSet)(nil), (*HyperLogLog)(nil), (*BloomFilter)(nil),
+		time.Time{}, time.Duration(0),
+	} {
+		r.Register(v)
+	}
+	return r
+}
+
+// Register records the type of value under its name as printed by %T, like
+// gob.Register.
+func (r *TypeRegistry) Register(value any) {
+	r.RegisterName(reflect.TypeOf(value).String(), value)
+}
+
+// RegisterName records the type of value under name. Panics if name is
+// already used for another type, like gob.RegisterName.
+func (r *TypeRegistry) RegisterName(name string, value any) {
+	t := reflect.TypeOf(value)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.byName[name]; ok && old != t {
+		panic(fmt.Sprintf("cache: registering duplicate types for %q: %s != %s", name, old, t))
+	}
+	r.byName[name] = t
+	r.byType[t] = name
+}
+
+// name returns the registered name of the type of x, or "" if it isn't
+// registered.
+func (r *TypeRegistry) name(x any) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byType[reflect.TypeOf(x)]
+}
+
+// typeOf returns the type registered under name. An empty name stands for
+// values of unregistered types, which are decoded as any.
+func (r *TypeRegistry) typeOf(name string) (reflect.Type, error) {
+	if name == "" {
+		return reflect.TypeOf((*any)(nil)).Elem(), nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("Type %q is not registered", name)
+	}
+	return t, nil
+}
+
+var (
+	gobEncoderType      = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+	gobDecoderType      = reflect.TypeOf((*gob.GobDecoder)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// marshalBinary returns the encoding of v if its type implements
+// gob.GobEncoder or encoding.BinaryMarshaler. The codecs store such values,
+// e.g. *SortedSet or time.Time, as byte strings.
+func marshalBinary(v reflect.Value) ([]byte, bool, error) {
+	switch {
+	case v.Type().Implements(gobEncoderType):
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return nil, false, nil
+		}
+		b, err := v.Interface().(gob.GobEncoder).GobEncode()
+		return b, true, err
+	case v.Type().Implements(binaryMarshalerType):
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return nil, false, nil
+		}
+		b, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		return b, true, err
+	}
+	return nil, false, nil
+}
+
+// unmarshalBinary decodes b, written by marshalBinary, into the value p
+// points to if p implements gob.GobDecoder or encoding.BinaryUnmarshaler.
+func unmarshalBinary(p reflect.Value, b []byte) (bool, error) {
+	switch {
+	case p.Type().Implements(gobDecoderType):
+		return true, p.Interface().(gob.GobDecoder).GobDecode(b)
+	case p.Type().Implements(binaryUnmarshalType):
+		return true, p.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	}
+	return false, nil
+}
@@ -0,0 +1,261 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// NewCBORCodec returns a codec encoding every item as a CBOR (RFC 8949) map
+// with the keys "key", "type", "value", "expiration" and "version", which can
+// be read from other languages. types names the types of the values; if it is
+// nil, NewTypeRegistry is used. Indefinite-length items are not supported when
+// decoding, and tags are ignored.
+func NewCBORCodec(types *TypeRegistry) Codec {
+	if types == nil {
+		types = NewTypeRegistry()
+	}
+	return cborCodec{types}
+}
+
+type cborCodec struct {
+	types *TypeRegistry
+}
+
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+func (c cborCodec) NewEncoder(w io.Writer) ItemEncoder {
+	return &cborEncoder{w: w, types: c.types}
+}
+
+func (c cborCodec) NewDecoder(r io.Reader) ItemDecoder {
+	return &cborDecoder{r: asByteReader(r), types: c.types}
+}
+
+type cborEncoder struct {
+	w     io.Writer
+	types *TypeRegistry
+	buf   cborWriter
+}
+
+func (e *cborEncoder) Encode(k string, item Item) error {
+	e.buf.Reset()
+	if err := encodeRecord(&e.buf, e.types, k, item); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+type cborDecoder struct {
+	r     byteReader
+	types *TypeRegistry
+}
+
+func (d *cborDecoder) Decode() (string, Item, error) {
+	rec, err := readCBOR(d.r)
+	if err != nil {
+		return "", Item{}, err
+	}
+	return decodeRecord(d.types, rec)
+}
+
+// CBOR major types.
+const (
+	cborUint = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+type cborWriter struct {
+	bytes.Buffer
+}
+
+// writeHead writes the initial byte of a data item of the major type, with
+// the argument n.
+func (w *cborWriter) writeHead(major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		w.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		w.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		w.WriteByte(major | 25)
+		w.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		w.WriteByte(major | 26)
+		w.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		w.WriteByte(major | 27)
+		w.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func (w *cborWriter) writeNil() {
+	w.WriteByte(0xf6)
+}
+
+func (w *cborWriter) writeBool(b bool) {
+	if b {
+		w.WriteByte(0xf5)
+	} else {
+		w.WriteByte(0xf4)
+	}
+}
+
+func (w *cborWriter) writeInt(i int64) {
+	if i >= 0 {
+		w.writeHead(cborUint, uint64(i))
+	} else {
+		w.writeHead(cborNegInt, uint64(-1-i))
+	}
+}
+
+func (w *cborWriter) writeUint(u uint64) {
+	w.writeHead(cborUint, u)
+}
+
+func (w *cborWriter) writeFloat32(f float32) {
+	w.WriteByte(0xfa)
+	w.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(f)))
+}
+
+func (w *cborWriter) writeFloat64(f float64) {
+	w.WriteByte(0xfb)
+	w.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (w *cborWriter) writeString(s string) {
+	w.writeHead(cborText, uint64(len(s)))
+	w.WriteString(s)
+}
+
+func (w *cborWriter) writeBytes(b []byte) {
+	w.writeHead(cborBytes, uint64(len(b)))
+	w.Write(b)
+}
+
+func (w *cborWriter) writeArrayHeader(n int) {
+	w.writeHead(cborArray, uint64(n))
+}
+
+func (w *cborWriter) writeMapHeader(n int) {
+	w.writeHead(cborMap, uint64(n))
+}
+
+// readCBOR reads a CBOR data item into a generic value.
+func readCBOR(r byteReader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := b>>5, b&0x1f
+	if major == cborSimple {
+		return readCBORSimple(r, info)
+	}
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		if n, err = readUintN(r, 1<<(info-24)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported CBOR additional information %d", info)
+	}
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("CBOR negative integer out of range")
+		}
+		return -1 - int64(n), nil
+	case cborBytes:
+		return readBytes(r, n)
+	case cborText:
+		b, err := readBytes(r, n)
+		return string(b), err
+	case cborArray:
+		a := make([]any, 0, capacity(n))
+		for i := uint64(0); i < n; i++ {
+			v, err := readCBOR(r)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case cborMap:
+		keys := make([]any, 0, capacity(n))
+		values := make([]any, 0, capacity(n))
+		for i := uint64(0); i < n; i++ {
+			k, err := readCBOR(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := readCBOR(r)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+		return genericMap(keys, values)
+	default:
+		// A tag: the tagged item is decoded as if it were untagged.
+		return readCBOR(r)
+	}
+}
+
+func readCBORSimple(r byteReader, info byte) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		u, err := readUintN(r, 2)
+		return halfToFloat64(uint16(u)), err
+	case 26:
+		u, err := readUintN(r, 4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 27:
+		u, err := readUintN(r, 8)
+		return math.Float64frombits(u), err
+	}
+	return nil, fmt.Errorf("Unsupported CBOR simple value %d", info)
+}
+
+// halfToFloat64 converts an IEEE 754 half-precision float.
+func halfToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+// NewJSONCodec returns a codec encoding every item as a JSON object with the
+// fields "key", "type", "value", "expiration" and "version", one object per
+// line. Values are encoded with encoding/json, except that values whose type
+// implements gob.GobEncoder or encoding.BinaryMarshaler but not json.Marshaler,
+// e.g. *SortedSet, are encoded as base64 strings. types names the types of
+// the values; if it is nil, NewTypeRegistry is used.
+func NewJSONCodec(types *TypeRegistry) Codec {
+	if types == nil {
+		types = NewTypeRegistry()
+	}
+	return jsonCodec{types}
+}
+
+type jsonCodec struct {
+	types *TypeRegistry
+}
+
+type jsonRecord struct {
+	Key        string          `json:"key"`
+	Type       string          `json:"type"`
+	Value      json.RawMessage `json:"value"`
+	Expiration int64           `json:"expiration"`
+	Version    uint64          `json:"version"`
+}
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (c jsonCodec) NewEncoder(w io.Writer) ItemEncoder {
+	return &jsonEncoder{enc: json.NewEncoder(w), types: c.types}
+}
+
+func (c jsonCodec) NewDecoder(r io.Reader) ItemDecoder {
+	return &jsonDecoder{dec: json.NewDecoder(r), types: c.types}
+}
+
+type jsonEncoder struct {
+	enc   *json.Encoder
+	types *TypeRegistry
+}
+
+func (e *jsonEncoder) Encode(k string, item Item) error {
+	var value any = item.Object
+	if v := reflect.ValueOf(item.Object); v.IsValid() && !v.Type().Implements(jsonMarshalerType) {
+		b, ok, err := marshalBinary(v)
+		if err != nil {
+			return err
+		}
+		if ok {
+			value = b
+		}
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return e.enc.Encode(&jsonRecord{
+		Key:        k,
+		Type:       e.types.name(item.Object),
+		Value:      raw,
+		Expiration: item.Expiration,
+		Version:    item.version,
+	})
+}
+
+type jsonDecoder struct {
+	dec   *json.Decoder
+	types *TypeRegistry
+}
+
+func (d *jsonDecoder) Decode() (string, Item, error) {
+	var rec jsonRecord
+	if err := d.dec.Decode(&rec); err != nil {
+		return "", Item{}, err
+	}
+	t, err := d.types.typeOf(rec.Type)
+	if err != nil {
+		return "", Item{}, err
+	}
+	v := reflect.New(t).Elem()
+	// p points to the value to unmarshal into: v itself, or, for a pointer
+	// type like *SortedSet, a newly allocated value.
+	p := v.Addr()
+	if t.Kind() == reflect.Pointer && string(rec.Value) != "null" {
+		v.Set(reflect.New(t.Elem()))
+		p = v
+	}
+	if err := unmarshalJSONValue(rec.Value, p); err != nil {
+		return "", Item{}, err
+	}
+	return rec.Key, Item{Object: v.Interface(), Expiration: rec.Expiration, version: rec.Version}, nil
+}
+
+// unmarshalJSONValue decodes raw into the value p points to, reversing the
+// encoding of jsonEncoder.
+func unmarshalJSONValue(raw json.RawMessage, p reflect.Value) error {
+	if !p.Type().Implements(jsonUnmarshalerType) && p.Type().Elem().Kind() != reflect.Interface {
+		var b []byte
+		if err := json.Unmarshal(raw, &b); err == nil {
+			if ok, err := unmarshalBinary(p, b); ok {
+				return err
+			}
+		}
+	}
+	return json.Unmarshal(raw, p.Interface())
+}
@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// NewMsgPackCodec returns a codec encoding every item as a MessagePack map
+// with the keys "key", "type", "value", "expiration" and "version", which can
+// be read from other languages. types names the types of the values; if it is
+// nil, NewTypeRegistry is used.
+func NewMsgPackCodec(types *TypeRegistry) Codec {
+	if types == nil {
+		types = NewTypeRegistry()
+	}
+	return msgpackCodec{types}
+}
+
+type msgpackCodec struct {
+	types *TypeRegistry
+}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (c msgpackCodec) NewEncoder(w io.Writer) ItemEncoder {
+	return &msgpackEncoder{w: w, types: c.types}
+}
+
+func (c msgpackCodec) NewDecoder(r io.Reader) ItemDecoder {
+	return &msgpackDecoder{r: asByteReader(r), types: c.types}
+}
+
+type msgpackEncoder struct {
+	w     io.Writer
+	types *TypeRegistry
+	buf   msgpackWriter
+}
+
+func (e *msgpackEncoder) Encode(k string, item Item) error {
+	e.buf.Reset()
+	if err := encodeRecord(&e.buf, e.types, k, item); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+type msgpackDecoder struct {
+	r     byteReader
+	types *TypeRegistry
+}
+
+func (d *msgpackDecoder) Decode() (string, Item, error) {
+	rec, err := readMsgPack(d.r)
+	if err != nil {
+		return "", Item{}, err
+	}
+	return decodeRecord(d.types, rec)
+}
+
+// byteReader is what the MessagePack and CBOR decoders read from.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// asByteReader returns r if it is a byteReader, like the *bytes.Buffer holding
+// the frames of a snapshot, so that nothing is read ahead of the current
+// record, and wraps it in a bufio.Reader otherwise.
+func asByteReader(r io.Reader) byteReader {
+	if br, ok := r.(byteReader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+type msgpackWriter struct {
+	bytes.Buffer
+}
+
+func (w *msgpackWriter) writeNil() {
+	w.WriteByte(0xc0)
+}
+
+func (w *msgpackWriter) writeBool(b bool) {
+	if b {
+		w.WriteByte(0xc3)
+	} else {
+		w.WriteByte(0xc2)
+	}
+}
+
+func (w *msgpackWriter) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		w.writeUint(uint64(i))
+	case i >= -32:
+		w.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8:
+		w.Write([]byte{0xd0, byte(int8(i))})
+	case i >= math.MinInt16:
+		w.WriteByte(0xd1)
+		w.Write(binary.BigEndian.AppendUint16(nil, uint16(int16(i))))
+	case i >= math.MinInt32:
+		w.WriteByte(0xd2)
+		w.Write(binary.BigEndian.AppendUint32(nil, uint32(int32(i))))
+	default:
+		w.WriteByte(0xd3)
+		w.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
+
+func (w *msgpackWriter) writeUint(u uint64) {
+	switch {
+	case u < 0x80:
+		w.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		w.Write([]byte{0xcc, byte(u)})
+	case u <= math.MaxUint16:
+		w.WriteByte(0xcd)
+		w.Write(binary.BigEndian.AppendUint16(nil, uint16(u)))
+	case u <= math.MaxUint32:
+		w.WriteByte(0xce)
+		w.Write(binary.BigEndian.AppendUint32(nil, uint32(u)))
+	default:
+		w.WriteByte(0xcf)
+		w.Write(binary.BigEndian.AppendUint64(nil, u))
+	}
+}
+
+func (w *msgpackWriter) writeFloat32(f float32) {
+	w.WriteByte(0xca)
+	w.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(f)))
+}
+
+func (w *msgpackWriter) writeFloat64(f float64) {
+	w.WriteByte(0xcb)
+	w.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+// writeHeader writes the header of a string, byte string, array or map of
+// length n. fix is the fixed-length format for short lengths, below fixMax,
+// or 0 if there is none; codes are the 8-, 16- and 32-bit formats, where a 0
+// code means the format doesn't exist.
+func (w *msgpackWriter) writeHeader(n int, fix byte, fixMax int, codes [3]byte) {
+	switch {
+	case fix != 0 && n < fixMax:
+		w.WriteByte(fix | byte(n))
+	case codes[0] != 0 && n <= math.MaxUint8:
+		w.Write([]byte{codes[0], byte(n)})
+	case n <= math.MaxUint16:
+		w.WriteByte(codes[1])
+		w.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		w.WriteByte(codes[2])
+		w.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func (w *msgpackWriter) writeString(s string) {
+	w.writeHeader(len(s), 0xa0, 32, [3]byte{0xd9, 0xda, 0xdb})
+	w.WriteString(s)
+}
+
+func (w *msgpackWriter) writeBytes(b []byte) {
+	w.writeHeader(len(b), 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+	w.Write(b)
+}
+
+func (w *msgpackWriter) writeArrayHeader(n int) {
+	w.writeHeader(n, 0x90, 16, [3]byte{0, 0xdc, 0xdd})
+}
+
+func (w *msgpackWriter) writeMapHeader(n int) {
+	w.writeHeader(n, 0x80, 16, [3]byte{0, 0xde, 0xdf})
+}
+
+// readMsgPack reads a MessagePack value into a generic value. Extension types
+// are not supported.
+func readMsgPack(r byteReader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b < 0x80:
+		return uint64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return readMsgPackString(r, uint64(b&0x1f))
+	case b&0xf0 == 0x90:
+		return readMsgPackArray(r, uint64(b&0x0f))
+	case b&0xf0 == 0x80:
+		return readMsgPackMap(r, uint64(b&0x0f))
+	}
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return readUintN(r, 1<<(b-0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		u, err := readUintN(r, size)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := readUintN(r, 4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := readUintN(r, 8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readUintN(r, 1<<(b-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgPackString(r, n)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readUintN(r, 1<<(b-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, n)
+	case 0xdc, 0xdd:
+		n, err := readUintN(r, 2<<(b-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgPackArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readUintN(r, 2<<(b-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgPackMap(r, n)
+	}
+	return nil, fmt.Errorf("Unsupported MessagePack format 0x%02x", b)
+}
+
+func readMsgPackString(r byteReader, n uint64) (any, error) {
+	b, err := readBytes(r, n)
+	return string(b), err
+}
+
+func readMsgPackArray(r byteReader, n uint64) (any, error) {
+	a := make([]any, 0, capacity(n))
+	for i := uint64(0); i < n; i++ {
+		v, err := readMsgPack(r)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func readMsgPackMap(r byteReader, n uint64) (any, error) {
+	keys := make([]any, 0, capacity(n))
+	values := make([]any, 0, capacity(n))
+	for i := uint64(0); i < n; i++ {
+		k, err := readMsgPack(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgPack(r)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	return genericMap(keys, values)
+}
+
+// readUintN reads a big-endian unsigned integer of size bytes.
+func readUintN(r io.Reader, size int) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codecProfile struct {
+	Name    string `json:"name"`
+	Visits  int    `json:"visits"`
+	Scores  []float64
+	private int
+}
+
+func TestCodecs(t *testing.T) {
+	types := NewTypeRegistry()
+	types.Register(codecProfile{})
+	codecs := []Codec{GobCodec, NewJSONCodec(types), NewMsgPackCodec(types), NewCBORCodec(types)}
+	created := time.Date(2024, 7, 3, 12, 0, 0, 0, time.UTC)
+
+	for _, codec := range codecs {
+		t.Run("Round trip with "+codec.Name(), func(t *testing.T) {
+			c := New(DefaultExpiration, 0)
+			c.Set("string", "value", NoExpiration)
+			c.Set("int", -42, NoExpiration)
+			c.Set("uint8", uint8(200), NoExpiration)
+			c.Set("float32", float32(1.5), NoExpiration)
+			c.Set("bytes", []byte{1, 2, 3}, NoExpiration)
+			c.Set("time", created, NoExpiration)
+			c.Set("duration", time.Minute, time.Hour)
+			c.Set("profile", codecProfile{Name: "ana", Visits: 3, Scores: []float64{1, 2.5}}, NoExpiration)
+			_, _ = c.RPush("list", "a", "b")
+			_, _ = c.HSet("hash", "field", "value")
+			_, _ = c.SAdd("set", "x", "y")
+			_, _ = c.ZAdd("zset", ZMember{Member: "m", Score: 2})
+
+			var buf bytes.Buffer
+			assert.NoError(t, c.SaveWith(&buf, codec))
+			loaded := New(DefaultExpiration, 0)
+			assert.NoError(t, loaded.LoadWith(&buf, codec))
+
+			for k, want := range c.Items() {
+				got, found := loaded.Items()[k]
+				if !assert.True(t, found, k) {
+					continue
+				}
+				assert.Equal(t, want.Expiration, got.Expiration, k)
+				if k == "zset" {
+					members, err := loaded.ZRangeByRank("zset", 0, -1)
+					assert.NoError(t, err)
+					assert.Equal(t, []ZMember{{Member: "m", Score: 2}}, members)
+					continue
+				}
+				assert.Equal(t, want.Object, got.Object, k)
+			}
+		})
+	}
+
+	t.Run("Decode unregistered types as generic values", func(t *testing.T) {
+		for _, codec := range codecs[1:] {
+			c := New(DefaultExpiration, 0)
+			c.Set("key", struct{ A string }{"x"}, NoExpiration)
+
+			var buf bytes.Buffer
+			assert.NoError(t, c.SaveWith(&buf, codec))
+			loaded := New(DefaultExpiration, 0)
+			assert.NoError(t, loaded.LoadWith(&buf, codec))
+
+			val, _ := loaded.Get("key")
+			assert.Equal(t, map[string]any{"A": "x"}, val, codec.Name())
+		}
+	})
+
+	t.Run("Reject snapshots saved with another codec", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", "value", NoExpiration)
+		var buf bytes.Buffer
+		assert.NoError(t, c.SaveWith(&buf, NewCBORCodec(nil)))
+
+		err := New(DefaultExpiration, 0).Load(&buf)
+		assert.ErrorContains(t, err, "saved with the cbor codec")
+	})
+}
+
+func TestCodecWireFormats(t *testing.T) {
+	value := map[string]any{"a": 1}
+
+	t.Run("MessagePack", func(t *testing.T) {
+		var w msgpackWriter
+		assert.NoError(t, encodeValue(&w, reflect.ValueOf(value)))
+		assert.Equal(t, []byte{0x81, 0xa1, 'a', 0x01}, w.Bytes())
+
+		v, err := readMsgPack(bytes.NewBuffer([]byte{0x92, 0xd0, 0x80, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}))
+		assert.NoError(t, err)
+		assert.Equal(t, []any{int64(-128), 1.5}, v)
+	})
+
+	t.Run("CBOR", func(t *testing.T) {
+		var w cborWriter
+		assert.NoError(t, encodeValue(&w, reflect.ValueOf(value)))
+		assert.Equal(t, []byte{0xa1, 0x61, 'a', 0x01}, w.Bytes())
+
+		v, err := readCBOR(bytes.NewBuffer([]byte{0x83, 0x38, 0x63, 0xf9, 0x3c, 0x00, 0xc1, 0x1a, 0, 0, 0, 1}))
+		assert.NoError(t, err)
+		assert.Equal(t, []any{int64(-100), 1.0, uint64(1)}, v)
+	})
+}
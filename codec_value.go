@@ -0,0 +1,392 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// The MessagePack and CBOR codecs share a data model: nil, booleans, integers,
+// floats, strings, byte strings, arrays and maps. encodeValue walks a Go value
+// and writes it with a valueWriter, and the codecs decode it into generic Go
+// values (nil, bool, int64, uint64, float64, string, []byte, []any,
+// map[string]any and map[any]any) that assignValue converts back into the
+// registered type.
+
+type valueWriter interface {
+	writeNil()
+	writeBool(b bool)
+	writeInt(i int64)
+	writeUint(u uint64)
+	writeFloat32(f float32)
+	writeFloat64(f float64)
+	writeString(s string)
+	writeBytes(b []byte)
+	writeArrayHeader(n int)
+	writeMapHeader(n int)
+}
+
+// encodeValue writes v. Values whose type implements gob.GobEncoder or
+// encoding.BinaryMarshaler are written as byte strings, and structs as maps
+// of their exported fields, named as by encoding/json.
+func encodeValue(w valueWriter, v reflect.Value) error {
+	if !v.IsValid() {
+		w.writeNil()
+		return nil
+	}
+	if b, ok, err := marshalBinary(v); ok || err != nil {
+		if err != nil {
+			return err
+		}
+		w.writeBytes(b)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32:
+		w.writeFloat32(float32(v.Float()))
+	case reflect.Float64:
+		w.writeFloat64(v.Float())
+	case reflect.String:
+		w.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			w.writeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		w.writeArrayHeader(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		w.writeMapHeader(v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := encodeValue(w, iter.Key()); err != nil {
+				return err
+			}
+			if err := encodeValue(w, iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		w.writeMapHeader(len(fields))
+		for _, f := range fields {
+			w.writeString(f.name)
+			if err := encodeValue(w, v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		return encodeValue(w, v.Elem())
+	default:
+		return fmt.Errorf("Can't encode values of type %s", v.Type())
+	}
+	return nil
+}
+
+type structField struct {
+	name  string
+	index int
+}
+
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields = append(fields, structField{name: name, index: i})
+	}
+	return fields
+}
+
+// assignValue stores the generic value src in dst, which must be settable,
+// converting it to dst's type.
+func assignValue(dst reflect.Value, src any) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if b, ok := src.([]byte); ok && dst.CanAddr() {
+		if ok, err := unmarshalBinary(dst.Addr(), b); ok {
+			return err
+		}
+	}
+	mismatch := func() error {
+		return fmt.Errorf("Can't decode %T into %s", src, dst.Type())
+	}
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(src))
+	case reflect.Pointer:
+		p := reflect.New(dst.Type().Elem())
+		if err := assignValue(p.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(p)
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch x := src.(type) {
+		case int64:
+			i = x
+		case uint64:
+			if x > math.MaxInt64 {
+				return mismatch()
+			}
+			i = int64(x)
+		default:
+			return mismatch()
+		}
+		if dst.OverflowInt(i) {
+			return mismatch()
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch x := src.(type) {
+		case uint64:
+			u = x
+		case int64:
+			if x < 0 {
+				return mismatch()
+			}
+			u = uint64(x)
+		default:
+			return mismatch()
+		}
+		if dst.OverflowUint(u) {
+			return mismatch()
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch x := src.(type) {
+		case float64:
+			dst.SetFloat(x)
+		case int64:
+			dst.SetFloat(float64(x))
+		case uint64:
+			dst.SetFloat(float64(x))
+		default:
+			return mismatch()
+		}
+	case reflect.String:
+		s, ok := src.(string)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetString(s)
+	case reflect.Slice:
+		if b, ok := src.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		a, ok := src.([]any)
+		if !ok {
+			return mismatch()
+		}
+		s := reflect.MakeSlice(dst.Type(), len(a), len(a))
+		for i, x := range a {
+			if err := assignValue(s.Index(i), x); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	case reflect.Array:
+		a, ok := src.([]any)
+		if !ok || len(a) != dst.Len() {
+			return mismatch()
+		}
+		for i, x := range a {
+			if err := assignValue(dst.Index(i), x); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m := reflect.MakeMap(dst.Type())
+		key := reflect.New(dst.Type().Key()).Elem()
+		elem := reflect.New(dst.Type().Elem()).Elem()
+		set := func(k, v any) error {
+			key.SetZero()
+			elem.SetZero()
+			if err := assignValue(key, k); err != nil {
+				return err
+			}
+			if err := assignValue(elem, v); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+			return nil
+		}
+		switch x := src.(type) {
+		case map[string]any:
+			for k, v := range x {
+				if err := set(k, v); err != nil {
+					return err
+				}
+			}
+		case map[any]any:
+			for k, v := range x {
+				if err := set(k, v); err != nil {
+					return err
+				}
+			}
+		default:
+			return mismatch()
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		m, ok := src.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+		for _, f := range structFields(dst.Type()) {
+			if x, ok := m[f.name]; ok {
+				if err := assignValue(dst.Field(f.index), x); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// genericMap returns a map[string]any if all keys are strings, and a
+// map[any]any otherwise. Byte string keys are converted to strings.
+func genericMap(keys, values []any) (any, error) {
+	for i, k := range keys {
+		switch x := k.(type) {
+		case []byte:
+			keys[i] = string(x)
+		case []any, map[string]any, map[any]any:
+			return nil, fmt.Errorf("Unsupported map key of type %T", k)
+		}
+	}
+	strKeys := make(map[string]any, len(keys))
+	for i, k := range keys {
+		s, ok := k.(string)
+		if !ok {
+			m := make(map[any]any, len(keys))
+			for j, k := range keys {
+				m[k] = values[j]
+			}
+			return m, nil
+		}
+		strKeys[s] = values[i]
+	}
+	return strKeys, nil
+}
+
+// encodeRecord writes an item as a map with the keys "key", "type", "value",
+// "expiration" and "version". "type" is the name the value's type is
+// registered under in types, or "" if it isn't registered.
+func encodeRecord(w valueWriter, types *TypeRegistry, k string, item Item) error {
+	w.writeMapHeader(5)
+	w.writeString("key")
+	w.writeString(k)
+	w.writeString("type")
+	w.writeString(types.name(item.Object))
+	w.writeString("value")
+	if err := encodeValue(w, reflect.ValueOf(item.Object)); err != nil {
+		return err
+	}
+	w.writeString("expiration")
+	w.writeInt(item.Expiration)
+	w.writeString("version")
+	w.writeUint(item.version)
+	return nil
+}
+
+// decodeRecord converts a record written by encodeRecord and decoded into a
+// generic value back into an item.
+func decodeRecord(types *TypeRegistry, rec any) (string, Item, error) {
+	var item Item
+	m, ok := rec.(map[string]any)
+	if !ok {
+		return "", item, fmt.Errorf("Can't decode %T into a record", rec)
+	}
+	k, _ := m["key"].(string)
+	name, _ := m["type"].(string)
+	t, err := types.typeOf(name)
+	if err != nil {
+		return "", item, err
+	}
+	v := reflect.New(t).Elem()
+	if err := assignValue(v, m["value"]); err != nil {
+		return "", item, err
+	}
+	item.Object = v.Interface()
+	if err := assignValue(reflect.ValueOf(&item.Expiration).Elem(), m["expiration"]); err != nil {
+		return "", item, err
+	}
+	if err := assignValue(reflect.ValueOf(&item.version).Elem(), m["version"]); err != nil {
+		return "", item, err
+	}
+	return k, item, nil
+}
+
+// readBytes reads n bytes from r without trusting n for the allocation, since
+// it comes from the input.
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	if n <= 4096 {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	b, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err == nil && uint64(len(b)) != n {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// capacity bounds the capacity preallocated for n elements read from the
+// input.
+func capacity(n uint64) int {
+	if n > 1024 {
+		return 1024
+	}
+	return int(n)
+}
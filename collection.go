@@ -0,0 +1,126 @@
+package cache
+
+import "fmt"
+
+// The list, set and hash commands, e.g. LPush, SAdd and HSet, store their
+// values as []string, StringSet and map[string]string items, so collections
+// created with Set can be used with them too. The commands modify these values
+// in place while holding the cache lock: a collection obtained with Get or
+// Items must not be used while other goroutines run commands on its key. Use
+// LRange, SMembers or HGetAll to get a copy instead.
+
+type collection interface {
+	~[]string | ~map[string]string | StringSet
+}
+
+// updateCollection calls f with the collection of type T stored under k, or
+// with the zero value of T if the key doesn't exist or has expired, and stores
+// the collection f returns. A new collection gets the cache's default
+// expiration; an existing one keeps its expiration time. If f returns an empty
+// collection, the key is deleted. Returns an error wrapping ErrWrongType if the
+// key holds another kind of value.
+func updateCollection[T collection](c *Cache, k string, f func(T) T) error {
+	c.mu.Lock()
+	item, found := c.lookup(k)
+	if !found {
+		item = Item{Expiration: c.expiration(DefaultExpiration)}
+	}
+	var coll T
+	if found {
+		var ok bool
+		if coll, ok = item.Object.(T); !ok {
+			c.mu.Unlock()
+			return wrongType(k, coll)
+		}
+	}
+	c.preserve(k)
+	coll = f(coll)
+	if len(coll) > 0 {
+		item.Object = coll
+		c.write(k, item)
+		c.mu.Unlock()
+		return nil
+	}
+	if !found {
+		c.mu.Unlock()
+		return nil
+	}
+	v, evicted := c.delete(k)
+	c.mu.Unlock()
+	if evicted {
+		c.onEvicted(k, v)
+	}
+	return nil
+}
+
+// readCollection calls f with the collection of type T stored under k, or
+// with the zero value of T if the key doesn't exist or has expired. Returns an
+// error wrapping ErrWrongType if the key holds another kind of value.
+func readCollection[T collection](c *Cache, k string, f func(T)) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var coll T
+	if x, found := c.get(k); found {
+		var ok bool
+		if coll, ok = x.(T); !ok {
+			return wrongType(k, coll)
+		}
+	}
+	f(coll)
+	return nil
+}
+
+func wrongType(k string, want any) error {
+	return fmt.Errorf("%w: %s does not hold a %T", ErrWrongType, k, want)
+}
+
+// updateValue calls f with the value of type T stored under k, or with a new
+// value from create if the key doesn't exist or has expired. A new value gets
+// the cache's default expiration; an existing one keeps its expiration time.
+// The value is stored if f returns true, and the key is deleted otherwise.
+// Returns an error wrapping ErrWrongType if the key holds another kind of
+// value. It is used for the value kinds that are modified through a pointer,
+// like *SortedSet.
+func updateValue[T any](c *Cache, k string, create func() T, f func(T) bool) error {
+	c.mu.Lock()
+	item, found := c.lookup(k)
+	if !found {
+		item = Item{Object: create(), Expiration: c.expiration(DefaultExpiration)}
+	}
+	x, ok := item.Object.(T)
+	if !ok {
+		c.mu.Unlock()
+		return wrongType(k, x)
+	}
+	c.preserve(k)
+	if f(x) {
+		c.write(k, item)
+		c.mu.Unlock()
+		return nil
+	}
+	if !found {
+		c.mu.Unlock()
+		return nil
+	}
+	v, evicted := c.delete(k)
+	c.mu.Unlock()
+	if evicted {
+		c.onEvicted(k, v)
+	}
+	return nil
+}
+
+// readValue calls f with the value of type T stored under k, and a bool
+// indicating whether the key was found. Returns an error wrapping ErrWrongType
+// if the key holds another kind of value.
+func readValue[T any](c *Cache, k string, f func(x T, found bool)) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	obj, found := c.get(k)
+	x, ok := obj.(T)
+	if found && !ok {
+		return wrongType(k, x)
+	}
+	f(x, found)
+	return nil
+}
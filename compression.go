@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+)
+
+// Compression compresses the items of a snapshot written by SaveWithOptions.
+// Its name is stored in the snapshot header, so LoadWithOptions can find it
+// again among the built-in compressions, Gzip and Flate, and those passed in
+// LoadOptions.Compressions, e.g. one wrapping a zstd library.
+type Compression interface {
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	// Gzip compresses snapshots with compress/gzip at the default level.
+	Gzip Compression = gzipCompression{}
+	// Flate compresses snapshots with compress/flate at the default level.
+	Flate Compression = flateCompression{}
+)
+
+type gzipCompression struct{}
+
+func (gzipCompression) Name() string {
+	return "gzip"
+}
+
+func (gzipCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type flateCompression struct{}
+
+func (flateCompression) Name() string {
+	return "flate"
+}
+
+func (flateCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
+func (flateCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
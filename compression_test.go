@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// identityCompression is a Compression that isn't built in. It "compresses" by
+// passing the data through unchanged.
+type identityCompression struct{}
+
+func (identityCompression) Name() string { return "identity" }
+
+func (identityCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (identityCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// closeCounter is a Compression whose writers count how often they are
+// closed.
+type closeCounter struct {
+	identityCompression
+	closed *int
+}
+
+func (c closeCounter) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return countingWriteCloser{w, c.closed}, nil
+}
+
+type countingWriteCloser struct {
+	io.Writer
+	closed *int
+}
+
+func (c countingWriteCloser) Close() error {
+	*c.closed++
+	return nil
+}
+
+// brokenWriter is an io.Writer that always fails.
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestCache_SaveWithOptions_Compression(t *testing.T) {
+	newCache := func() *Cache {
+		c := New(DefaultExpiration, 0)
+		for i := 0; i < 3*saveChunkSize; i++ {
+			c.Set(fmt.Sprintf("key%d", i), strings.Repeat("value", 10), NoExpiration)
+		}
+		return c
+	}
+
+	for _, comp := range []Compression{Gzip, Flate} {
+		t.Run("Round trip with "+comp.Name(), func(t *testing.T) {
+			var plain, compressed bytes.Buffer
+			assert.NoError(t, newCache().Save(&plain))
+			assert.NoError(t, newCache().SaveWithOptions(&compressed, SaveOptions{Compression: comp}))
+			assert.Less(t, compressed.Len(), plain.Len()/2)
+
+			info, err := ReadSnapshotInfo(bytes.NewReader(compressed.Bytes()))
+			assert.NoError(t, err)
+			assert.Equal(t, comp.Name(), info.Compression)
+			assert.Equal(t, 3*saveChunkSize, info.Count)
+
+			c := New(DefaultExpiration, 0)
+			assert.NoError(t, c.Load(bytes.NewReader(compressed.Bytes())))
+			assert.Equal(t, 3*saveChunkSize, c.ItemCount())
+		})
+	}
+
+	t.Run("Reject truncated compressed snapshots", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, newCache().SaveWithOptions(&buf, SaveOptions{Compression: Gzip}))
+		data := buf.Bytes()
+		for _, n := range []int{60, len(data) / 2, len(data) - 2} {
+			c := New(DefaultExpiration, 0)
+			err := c.Load(bytes.NewReader(data[:n]))
+			assert.ErrorIs(t, err, ErrInvalidSnapshot)
+			assert.Zero(t, c.ItemCount())
+		}
+	})
+
+	t.Run("Use compressions passed in LoadOptions", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, newCache().SaveWithOptions(&buf, SaveOptions{Compression: identityCompression{}}))
+
+		info, err := ReadSnapshotInfo(bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, "identity", info.Compression)
+		assert.Equal(t, -1, info.Count)
+
+		c := New(DefaultExpiration, 0)
+		err = c.Load(bytes.NewReader(buf.Bytes()))
+		assert.ErrorContains(t, err, "compressed with identity")
+		assert.Zero(t, c.ItemCount())
+
+		opts := LoadOptions{Compressions: []Compression{identityCompression{}}}
+		assert.NoError(t, c.LoadWithOptions(bytes.NewReader(buf.Bytes()), opts))
+		assert.Equal(t, 3*saveChunkSize, c.ItemCount())
+	})
+
+	t.Run("Save and load files", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "cache.snapshot")
+		assert.NoError(t, newCache().SaveFileWithOptions(fname, SaveOptions{Compression: Flate}))
+
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.LoadFileWithOptions(fname, LoadOptions{}))
+		assert.Equal(t, 3*saveChunkSize, c.ItemCount())
+	})
+	t.Run("Close the compressor when saving fails", func(t *testing.T) {
+		var closed int
+		err := newCache().SaveWithOptions(brokenWriter{}, SaveOptions{Compression: closeCounter{closed: &closed}})
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+		assert.Equal(t, 1, closed)
+	})
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Encrypted snapshots split the data following the header into chunks of up
+// to encryptedChunkSize bytes, each sealed with AES-GCM and written as a flag
+// byte, set for the last chunk, the big-endian uint32 length of the sealed
+// chunk, and the sealed chunk.
+//
+// Every snapshot is encrypted with its own key, derived from the user's key
+// and the random salt in the header with HKDF-SHA256, so the nonce of a chunk
+// can be a counter: seven zero bytes, the chunk's big-endian uint32 index and
+// the flag byte. The additional data of a chunk is the header, so chunks can't
+// be reordered, dropped or moved to another snapshot, and the header can't be
+// modified, without failing authentication.
+
+const (
+	encryptedChunkSize = 64 << 10
+	saltSize           = 32
+)
+
+// hkdfInfo binds the derived keys to their use.
+const hkdfInfo = "go-cache snapshot"
+
+// newGCM returns the AEAD of the snapshot with the given salt.
+func newGCM(key, salt []byte) (cipher.AEAD, error) {
+	if n := len(key); n != 16 && n != 24 && n != 32 {
+		return nil, aes.KeySizeError(n)
+	}
+	block, err := aes.NewCipher(deriveKey(key, salt))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives a key as long as key from key and salt with HKDF-SHA256
+// (RFC 5869). A single block of the expansion is enough for AES keys.
+func deriveKey(key, salt []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(key)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(hkdfInfo))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:len(key)]
+}
+
+func chunkNonce(index uint32, last bool) []byte {
+	nonce := make([]byte, 7, 12)
+	nonce = binary.BigEndian.AppendUint32(nonce, index)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint32
+}
+
+func newEncryptWriter(w io.Writer, aead cipher.AEAD, header []byte) *encryptWriter {
+	return &encryptWriter{w: w, aead: aead, header: header, buf: make([]byte, 0, encryptedChunkSize)}
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(e.buf) == encryptedChunkSize {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(e.buf[len(e.buf):encryptedChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close writes the last chunk, which may be empty.
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.index, last), e.buf, e.header)
+	var head [5]byte
+	if last {
+		head[0] = 1
+	}
+	binary.BigEndian.PutUint32(head[1:], uint32(len(sealed)))
+	if _, err := e.w.Write(head[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint32
+	last   bool
+}
+
+func newDecryptReader(r io.Reader, aead cipher.AEAD, header []byte) *decryptReader {
+	return &decryptReader{r: r, aead: aead, header: header}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.last {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	var head [5]byte
+	if _, err := io.ReadFull(d.r, head[:]); err != nil {
+		return fmt.Errorf("%w: encrypted data truncated", ErrInvalidSnapshot)
+	}
+	last := head[0] == 1
+	size := binary.BigEndian.Uint32(head[1:])
+	if head[0] > 1 || size > encryptedChunkSize+uint32(d.aead.Overhead()) {
+		return fmt.Errorf("%w: corrupt encrypted chunk", ErrInvalidSnapshot)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("%w: encrypted data truncated", ErrInvalidSnapshot)
+	}
+	plain, err := d.aead.Open(sealed[:0], chunkNonce(d.index, last), sealed, d.header)
+	if err != nil {
+		return ErrWrongKey
+	}
+	d.buf = plain
+	d.index++
+	d.last = last
+	return nil
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_SaveWithOptions_Encryption(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+	keys := map[string][]byte{"2024-07": key}
+
+	save := func(t *testing.T, opts SaveOptions) []byte {
+		c := New(DefaultExpiration, 0)
+		// Enough items for several encrypted chunks.
+		for i := 0; i < 20*saveChunkSize; i++ {
+			c.Set(fmt.Sprintf("key%d", i), i, NoExpiration)
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, c.SaveWithOptions(&buf, opts))
+		return buf.Bytes()
+	}
+
+	t.Run("Round trip", func(t *testing.T) {
+		for _, comp := range []Compression{nil, Gzip} {
+			data := save(t, SaveOptions{Key: key, KeyID: "2024-07", Compression: comp})
+			assert.NotContains(t, string(data), "key1234")
+
+			info, err := ReadSnapshotInfo(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.True(t, info.Encrypted)
+			assert.Equal(t, "2024-07", info.KeyID)
+			assert.Equal(t, -1, info.Count)
+
+			c := New(DefaultExpiration, 0)
+			assert.NoError(t, c.LoadWithOptions(bytes.NewReader(data), LoadOptions{Keys: keys}))
+			assert.Equal(t, 20*saveChunkSize, c.ItemCount())
+			val, _ := c.Get("key1234")
+			assert.Equal(t, 1234, val)
+		}
+	})
+
+	t.Run("Fail cleanly with the wrong key", func(t *testing.T) {
+		data := save(t, SaveOptions{Key: key, KeyID: "2024-07"})
+		c := New(DefaultExpiration, 0)
+		c.Set("existing", 1, NoExpiration)
+
+		err := c.LoadWithOptions(bytes.NewReader(data), LoadOptions{Keys: map[string][]byte{"2024-07": otherKey}})
+		assert.ErrorIs(t, err, ErrWrongKey)
+		err = c.LoadWithOptions(bytes.NewReader(data), LoadOptions{Keys: map[string][]byte{"2024-08": key}})
+		assert.ErrorIs(t, err, ErrWrongKey)
+		assert.ErrorContains(t, err, `"2024-07"`)
+		err = c.Load(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrWrongKey)
+		assert.Equal(t, 1, c.ItemCount())
+	})
+
+	t.Run("Reject modified snapshots", func(t *testing.T) {
+		data := save(t, SaveOptions{Key: key, KeyID: "2024-07"})
+		// The default expiration in the header, a byte of the first chunk and
+		// a byte of the last chunk.
+		for _, i := range []int{len(snapshotMagic) + 12, len(data) / 3, len(data) - 5} {
+			modified := bytes.Clone(data)
+			modified[i] ^= 0xff
+			c := New(DefaultExpiration, 0)
+			err := c.LoadWithOptions(bytes.NewReader(modified), LoadOptions{Keys: keys})
+			assert.ErrorIs(t, err, ErrWrongKey)
+			assert.Zero(t, c.ItemCount())
+		}
+	})
+
+	t.Run("Reject truncated snapshots", func(t *testing.T) {
+		data := save(t, SaveOptions{Key: key, KeyID: "2024-07"})
+		for _, n := range []int{len(data) / 2, len(data) - 40, len(data) - 1} {
+			c := New(DefaultExpiration, 0)
+			err := c.LoadWithOptions(bytes.NewReader(data[:n]), LoadOptions{Keys: keys})
+			assert.ErrorIs(t, err, ErrInvalidSnapshot)
+			assert.Zero(t, c.ItemCount())
+		}
+	})
+
+	t.Run("Reject invalid keys", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		var buf bytes.Buffer
+		assert.Error(t, c.SaveWithOptions(&buf, SaveOptions{Key: []byte("short")}))
+	})
+	t.Run("Encrypt every snapshot with its own key", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+		var a, b bytes.Buffer
+		assert.NoError(t, c.SaveWithOptions(&a, SaveOptions{Key: key}))
+		assert.NoError(t, c.SaveWithOptions(&b, SaveOptions{Key: key}))
+
+		header := func(data []byte) snapshotHeader {
+			cr := &crcReader{r: bufio.NewReader(bytes.NewReader(data)), crc: crc32.New(crc32c)}
+			_, h, err := readSnapshotHeader(cr)
+			assert.NoError(t, err)
+			return h
+		}
+		ha, hb := header(a.Bytes()), header(b.Bytes())
+		assert.NotEqual(t, ha.salt, hb.salt)
+		assert.NotEqual(t, deriveKey(key, ha.salt), deriveKey(key, hb.salt))
+		assert.NotEqual(t, a.Bytes()[len(ha.raw):], b.Bytes()[len(hb.raw):])
+	})
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrConflict is returned by Txn when a watched key was modified after it
+	// was watched, and is wrapped by VersionConflictError.
+	ErrConflict = errors.New("Item was modified concurrently")
+	// ErrUndeclaredKey is returned by a sharded cache's Txn when the
+	// transaction accesses a key that was not declared up front.
+	ErrUndeclaredKey = errors.New("Key was not declared in the transaction")
+	// ErrOverflow is returned by the increment and decrement methods when the
+	// result doesn't fit in the item's type and the cache's overflow policy is
+	// OverflowError.
+	ErrOverflow = errors.New("Numeric overflow")
+	// ErrNaNScore is returned by ZAdd and ZIncrBy when a score, or the result
+	// of an increment, is not a number.
+	ErrNaNScore = errors.New("Resulting score is not a number")
+	// ErrWrongType is returned by the collection commands, e.g. LPush, when the
+	// key holds a different kind of value.
+	ErrWrongType = errors.New("Operation against a key holding the wrong kind of value")
+	// ErrNotFound is returned by a Loader when the key doesn't exist in the
+	// underlying data source, and by GetOrLoad for such keys.
+	ErrNotFound = errors.New("Item not found")
+	// ErrInvalidSnapshot is wrapped by the errors Load returns for snapshots
+	// that are truncated, corrupt or of an unsupported version.
+	ErrInvalidSnapshot = errors.New("Invalid snapshot")
+	// ErrWrongKey is returned by LoadWithOptions when an encrypted snapshot
+	// can't be decrypted with the key for its key ID, either because the key
+	// is wrong or because the snapshot was modified.
+	ErrWrongKey = errors.New("Snapshot can't be decrypted with the given key")
+	// ErrStoreBacklog is passed to a Store's OnError when a write-behind change
+	// is dropped because MaxPending keys are already waiting to be flushed.
+	ErrStoreBacklog = errors.New("Too many changes waiting for the store")
+	// ErrCorruptLog is wrapped by the error OpenAOF returns when a record of
+	// the append-only log is corrupt.
+	ErrCorruptLog = errors.New("Append-only log is corrupt")
+)
+
+// VersionConflictError is returned by SetIfVersion when the item's current
+// version doesn't match the expected one. A version of 0 means the item
+// doesn't exist.
+type VersionConflictError struct {
+	Key      string
+	Expected uint64
+	Actual   uint64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("Item %s has version %d, expected %d", e.Key, e.Actual, e.Expected)
+}
+
+// Unwrap makes errors.Is(err, ErrConflict) report true.
+func (e *VersionConflictError) Unwrap() error {
+	return ErrConflict
+}
@@ -0,0 +1,59 @@
+package cache
+
+// HSet sets field to value in the hash stored under k, creating the hash if
+// the key doesn't exist. Returns true if the field is new.
+func (c *Cache) HSet(k string, field, value string) (bool, error) {
+	var created bool
+	err := updateCollection(c, k, func(h map[string]string) map[string]string {
+		if h == nil {
+			h = make(map[string]string)
+		}
+		_, found := h[field]
+		created = !found
+		h[field] = value
+		return h
+	})
+	return created, err
+}
+
+// HGet returns the value of field in the hash stored under k, and a bool
+// indicating whether the field was found.
+func (c *Cache) HGet(k string, field string) (string, bool, error) {
+	var (
+		value string
+		found bool
+	)
+	err := readCollection(c, k, func(h map[string]string) {
+		value, found = h[field]
+	})
+	return value, found, err
+}
+
+// HDel removes fields from the hash stored under k. Returns the number of
+// fields that were in the hash. The key is deleted when its last field is
+// removed.
+func (c *Cache) HDel(k string, fields ...string) (int, error) {
+	var n int
+	err := updateCollection(c, k, func(h map[string]string) map[string]string {
+		for _, f := range fields {
+			if _, found := h[f]; found {
+				delete(h, f)
+				n++
+			}
+		}
+		return h
+	})
+	return n, err
+}
+
+// HGetAll returns a copy of the hash stored under k.
+func (c *Cache) HGetAll(k string) (map[string]string, error) {
+	var res map[string]string
+	err := readCollection(c, k, func(h map[string]string) {
+		res = make(map[string]string, len(h))
+		for f, v := range h {
+			res[f] = v
+		}
+	})
+	return res, err
+}
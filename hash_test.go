@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_HSet(t *testing.T) {
+	t.Run("Set new and existing fields", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		created, err := c.HSet("hash", "name", "ana")
+		assert.NoError(t, err)
+		assert.True(t, created)
+
+		created, err = c.HSet("hash", "name", "bea")
+		assert.NoError(t, err)
+		assert.False(t, created)
+
+		value, found, _ := c.HGet("hash", "name")
+		assert.True(t, found)
+		assert.Equal(t, "bea", value)
+	})
+
+	t.Run("Set a field of a map stored with Set", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("hash", map[string]string{"a": "1"}, NoExpiration)
+
+		_, err := c.HSet("hash", "b", "2")
+		assert.NoError(t, err)
+
+		h, _ := c.HGetAll("hash")
+		assert.Equal(t, map[string]string{"a": "1", "b": "2"}, h)
+	})
+
+	t.Run("Set a field of a key holding another kind of value", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", 1, NoExpiration)
+		_, err := c.HSet("key", "a", "1")
+		assert.ErrorIs(t, err, ErrWrongType)
+
+		_, _, err = c.HGet("key", "a")
+		assert.ErrorIs(t, err, ErrWrongType)
+	})
+}
+
+func TestCache_HDel(t *testing.T) {
+	t.Run("Delete fields and the empty hash", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.HSet("hash", "a", "1")
+		_, _ = c.HSet("hash", "b", "2")
+
+		n, err := c.HDel("hash", "a", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		_, _ = c.HDel("hash", "b")
+		_, found := c.Get("hash")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_HGetAll(t *testing.T) {
+	t.Run("Get a copy of the hash", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.HSet("hash", "a", "1")
+
+		h, err := c.HGetAll("hash")
+		assert.NoError(t, err)
+		h["b"] = "2"
+
+		_, found, _ := c.HGet("hash", "b")
+		assert.False(t, found)
+	})
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	hllPrecision = 14
+	hllRegisters = 1 << hllPrecision
+)
+
+// HyperLogLog is the value stored by PFAdd. It estimates the number of
+// distinct elements added to it with a standard error of about 0.81%, using
+// 16 KB of memory.
+type HyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]uint8, hllRegisters)}
+}
+
+// hash64 hashes s with FNV-1a, followed by the MurmurHash3 finalizer to spread
+// the bits. Unlike hash/maphash it doesn't depend on a per-process seed, so
+// saved HyperLogLog and BloomFilter values stay valid across processes.
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return fmix64(h.Sum64())
+}
+
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// add adds an element, returning true if a register changed.
+func (h *HyperLogLog) add(s string) bool {
+	x := hash64(s)
+	i := x >> (64 - hllPrecision)
+	// The guard bit bounds the rank when the remaining bits are all zero.
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank <= h.registers[i] {
+		return false
+	}
+	h.registers[i] = rank
+	return true
+}
+
+// merge sets every register to the maximum of its value in h and in o.
+func (h *HyperLogLog) merge(o *HyperLogLog) {
+	for i, r := range o.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// count returns the estimated number of distinct elements.
+func (h *HyperLogLog) count() uint64 {
+	const m = float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Use linear counting for small cardinalities.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// GobEncode encodes the registers of the HyperLogLog.
+func (h *HyperLogLog) GobEncode() ([]byte, error) {
+	return append([]byte{}, h.registers...), nil
+}
+
+// GobDecode decodes a HyperLogLog encoded by GobEncode.
+func (h *HyperLogLog) GobDecode(b []byte) error {
+	if len(b) != hllRegisters {
+		return fmt.Errorf("Invalid HyperLogLog of %d bytes", len(b))
+	}
+	h.registers = append([]uint8{}, b...)
+	return nil
+}
+
+// PFAdd adds elements to the HyperLogLog stored under k, creating it if the
+// key doesn't exist. Returns true if the estimated cardinality may have
+// changed.
+func (c *Cache) PFAdd(k string, elements ...string) (bool, error) {
+	var changed bool
+	err := updateValue(c, k, newHyperLogLog, func(h *HyperLogLog) bool {
+		for _, e := range elements {
+			if h.add(e) {
+				changed = true
+			}
+		}
+		return true
+	})
+	return changed, err
+}
+
+// PFCount returns the estimated number of distinct elements added to the
+// HyperLogLogs stored under the given keys, that is, the cardinality of their
+// union. Missing keys count as empty.
+func (c *Cache) PFCount(keys ...string) (uint64, error) {
+	union := newHyperLogLog()
+	for _, k := range keys {
+		err := readValue(c, k, func(h *HyperLogLog, found bool) {
+			if found {
+				union.merge(h)
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return union.count(), nil
+}
+
+// PFMerge merges the HyperLogLogs stored under the source keys into the one
+// stored under dest, creating it if the key doesn't exist.
+func (c *Cache) PFMerge(dest string, sources ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	union := newHyperLogLog()
+	for _, k := range sources {
+		obj, found := c.get(k)
+		if !found {
+			continue
+		}
+		h, ok := obj.(*HyperLogLog)
+		if !ok {
+			return wrongType(k, h)
+		}
+		union.merge(h)
+	}
+	item, found := c.lookup(dest)
+	if !found {
+		item = Item{Object: newHyperLogLog(), Expiration: c.expiration(DefaultExpiration)}
+	}
+	h, ok := item.Object.(*HyperLogLog)
+	if !ok {
+		return wrongType(dest, h)
+	}
+	c.preserve(dest)
+	h.merge(union)
+	c.write(dest, item)
+	return nil
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_PFAdd(t *testing.T) {
+	t.Run("Count distinct elements", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		changed, err := c.PFAdd("visitors", "a", "b", "c")
+		assert.NoError(t, err)
+		assert.True(t, changed)
+
+		changed, _ = c.PFAdd("visitors", "a", "b")
+		assert.False(t, changed)
+
+		n, err := c.PFCount("visitors")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(3), n)
+	})
+
+	t.Run("Estimate large cardinalities within 2%", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		for i := 0; i < 100000; i++ {
+			_, _ = c.PFAdd("visitors", fmt.Sprintf("user-%d", i))
+		}
+
+		n, _ := c.PFCount("visitors")
+		assert.InEpsilon(t, 100000, n, 0.02)
+	})
+
+	t.Run("Add to a key holding another kind of value", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", "value", NoExpiration)
+		_, err := c.PFAdd("key", "a")
+		assert.ErrorIs(t, err, ErrWrongType)
+	})
+}
+
+func TestCache_PFCount(t *testing.T) {
+	t.Run("Count the union of several keys", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.PFAdd("monday", "a", "b")
+		_, _ = c.PFAdd("tuesday", "b", "c")
+
+		n, err := c.PFCount("monday", "tuesday", "missing")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(3), n)
+	})
+}
+
+func TestCache_PFMerge(t *testing.T) {
+	t.Run("Merge into a new key", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.PFAdd("monday", "a", "b")
+		_, _ = c.PFAdd("tuesday", "b", "c")
+
+		assert.NoError(t, c.PFMerge("week", "monday", "tuesday"))
+
+		n, _ := c.PFCount("week")
+		assert.Equal(t, uint64(3), n)
+	})
+
+	t.Run("Concurrent adds are not lost", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.PFAdd("monday", "a")
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				_, _ = c.PFAdd("week", fmt.Sprintf("user%d", i))
+			}(i)
+			go func() {
+				defer wg.Done()
+				_ = c.PFMerge("week", "monday")
+			}()
+		}
+		wg.Wait()
+
+		n, _ := c.PFCount("week")
+		assert.Equal(t, uint64(51), n)
+	})
+
+	t.Run("Merge a key holding another kind of value", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("monday", "a", NoExpiration)
+
+		assert.ErrorIs(t, c.PFMerge("week", "monday"), ErrWrongType)
+		_, found := c.Get("week")
+		assert.False(t, found)
+	})
+}
+
+func TestHyperLogLog_Gob(t *testing.T) {
+	t.Run("Save and load a HyperLogLog", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.PFAdd("visitors", "a", "b", "c")
+		var buf bytes.Buffer
+		assert.NoError(t, c.Save(&buf))
+
+		c2 := New(DefaultExpiration, 0)
+		assert.NoError(t, c2.Load(&buf))
+
+		n, err := c2.PFCount("visitors")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(3), n)
+	})
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -446,3 +447,70 @@ func TestCache_IncrementFloat64(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestCache_IncrementOrInitInt64(t *testing.T) {
+	t.Run("Create a missing item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		newVal, err := c.IncrementOrInitInt64("key", 5, 100, time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(105), newVal)
+
+		val, exp, found := c.GetWithExpiration("key")
+		assert.True(t, found)
+		assert.Equal(t, int64(105), val)
+		assert.False(t, exp.IsZero())
+	})
+
+	t.Run("Increment an existing item and keep its expiration", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", int64(10), NoExpiration)
+		newVal, err := c.IncrementOrInitInt64("key", 5, 100, time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(15), newVal)
+
+		_, exp, _ := c.GetWithExpiration("key")
+		assert.True(t, exp.IsZero())
+	})
+
+	t.Run("Recreate an expired item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", int64(10), time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+		newVal, err := c.IncrementOrInitInt64("key", 1, 0, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), newVal)
+	})
+
+	t.Run("Increment an item of another type", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", 10, NoExpiration)
+		_, err := c.IncrementOrInitInt64("key", 1, 0, NoExpiration)
+		assert.Error(t, err)
+	})
+}
+
+func TestCache_IncrementOrInitUint64(t *testing.T) {
+	t.Run("Create then increment", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		newVal, err := c.IncrementOrInitUint64("key", 1, 0, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), newVal)
+
+		newVal, err = c.IncrementOrInitUint64("key", 1, 0, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), newVal)
+	})
+}
+
+func TestCache_IncrementOrInitFloat64(t *testing.T) {
+	t.Run("Create then increment", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		newVal, err := c.IncrementOrInitFloat64("key", 0.5, 1, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.5, newVal)
+
+		newVal, err = c.IncrementOrInitFloat64("key", 0.5, 1, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, 2.0, newVal)
+	})
+}
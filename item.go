@@ -4,10 +4,22 @@ import (
 	"time"
 )
 
-// Item cache struct
+// Item cache struct.
 type Item struct {
 	Object     any
 	Expiration int64
+	// version is assigned by the cache every time the item is written. See
+	// Version.
+	version uint64
+	// saved is the generation of the last Save that wrote the item. See
+	// snapshotWriter.
+	saved uint64
+}
+
+// Version returns the version the cache assigned to the item when it was last
+// written. Versions increase monotonically, so they can be used as CAS tokens.
+func (item Item) Version() uint64 {
+	return item.version
 }
 
 // Expired Returns true if the item has expired.
@@ -15,13 +27,22 @@ func (item Item) Expired() bool {
 	return item.Expiration > 0 && time.Now().UnixNano() > item.Expiration
 }
 
+// tombstone reports whether the item records a key that the loader couldn't
+// find. See GetOrLoad.
+func (item Item) tombstone() bool {
+	_, ok := item.Object.(tombstone)
+	return ok
+}
+
 // Items Copies all unexpired items in the cache into a new map and returns it.
+// Tombstones left by GetOrLoad are not included.
 func (c *Cache) Items() map[string]Item {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	m := make(map[string]Item, len(c.items))
 	for k, v := range c.items {
-		if !v.Expired() {
+		if !v.Expired() && !v.tombstone() {
+			v.saved = 0
 			m[k] = v
 		}
 	}
@@ -0,0 +1,89 @@
+package cache
+
+// LPush inserts values at the head of the list stored under k, creating the
+// list if the key doesn't exist. The values are inserted one after the other,
+// so the last one ends up first, as in Redis. Returns the length of the list.
+func (c *Cache) LPush(k string, values ...string) (int, error) {
+	var n int
+	err := updateCollection(c, k, func(l []string) []string {
+		res := make([]string, 0, len(l)+len(values))
+		for i := len(values) - 1; i >= 0; i-- {
+			res = append(res, values[i])
+		}
+		res = append(res, l...)
+		n = len(res)
+		return res
+	})
+	return n, err
+}
+
+// RPush appends values at the tail of the list stored under k, creating the
+// list if the key doesn't exist. Returns the length of the list.
+func (c *Cache) RPush(k string, values ...string) (int, error) {
+	var n int
+	err := updateCollection(c, k, func(l []string) []string {
+		l = append(l, values...)
+		n = len(l)
+		return l
+	})
+	return n, err
+}
+
+// LPop removes and returns the first element of the list stored under k.
+// Returns the element, and a bool indicating whether the list was found and
+// not empty. The key is deleted when its last element is removed.
+func (c *Cache) LPop(k string) (string, bool, error) {
+	var (
+		x     string
+		found bool
+	)
+	err := updateCollection(c, k, func(l []string) []string {
+		if len(l) == 0 {
+			return l
+		}
+		x, found = l[0], true
+		return l[1:]
+	})
+	return x, found, err
+}
+
+// RPop removes and returns the last element of the list stored under k. See
+// LPop.
+func (c *Cache) RPop(k string) (string, bool, error) {
+	var (
+		x     string
+		found bool
+	)
+	err := updateCollection(c, k, func(l []string) []string {
+		if len(l) == 0 {
+			return l
+		}
+		x, found = l[len(l)-1], true
+		return l[: len(l)-1 : len(l)-1]
+	})
+	return x, found, err
+}
+
+// LRange returns a copy of the elements of the list stored under k between
+// the offsets start and stop, both inclusive. Negative offsets count from the
+// end of the list, so -1 is the last element. Out of range offsets are
+// clamped, as in Redis.
+func (c *Cache) LRange(k string, start, stop int) ([]string, error) {
+	var res []string
+	err := readCollection(c, k, func(l []string) {
+		if start < 0 {
+			start += len(l)
+		}
+		if stop < 0 {
+			stop += len(l)
+		}
+		start = max(start, 0)
+		stop = min(stop, len(l)-1)
+		if start > stop {
+			res = []string{}
+			return
+		}
+		res = append([]string{}, l[start:stop+1]...)
+	})
+	return res, err
+}
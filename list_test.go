@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_LPush(t *testing.T) {
+	t.Run("Push values at the head", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		n, err := c.LPush("list", "a", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		n, err = c.LPush("list", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		l, _ := c.LRange("list", 0, -1)
+		assert.Equal(t, []string{"c", "b", "a"}, l)
+	})
+
+	t.Run("Push to a key holding another kind of value", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", "value", NoExpiration)
+		_, err := c.LPush("key", "a")
+		assert.ErrorIs(t, err, ErrWrongType)
+	})
+
+	t.Run("Push keeps the expiration of an existing list", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("list", []string{"a"}, time.Hour)
+		_, exp1, _ := c.GetWithExpiration("list")
+
+		_, err := c.LPush("list", "b")
+		assert.NoError(t, err)
+
+		_, exp2, _ := c.GetWithExpiration("list")
+		assert.Equal(t, exp1, exp2)
+	})
+}
+
+func TestCache_RPush(t *testing.T) {
+	t.Run("Push values at the tail", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		n, err := c.RPush("list", "a", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		l, _ := c.LRange("list", 0, -1)
+		assert.Equal(t, []string{"a", "b"}, l)
+	})
+}
+
+func TestCache_LPop(t *testing.T) {
+	t.Run("Pop from the head and delete the empty list", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.RPush("list", "a", "b")
+
+		x, found, err := c.LPop("list")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "a", x)
+
+		x, found, _ = c.LPop("list")
+		assert.True(t, found)
+		assert.Equal(t, "b", x)
+
+		_, found, _ = c.LPop("list")
+		assert.False(t, found)
+		_, found = c.Get("list")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_RPop(t *testing.T) {
+	t.Run("Pop from the tail without affecting earlier reads", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.RPush("list", "a", "b")
+		before, _ := c.Get("list")
+
+		x, found, err := c.RPop("list")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "b", x)
+
+		_, _ = c.RPush("list", "c")
+		assert.Equal(t, []string{"a", "b"}, before)
+	})
+}
+
+func TestCache_LRange(t *testing.T) {
+	c := New(DefaultExpiration, 0)
+	_, _ = c.RPush("list", "a", "b", "c", "d")
+
+	t.Run("Range with positive and negative offsets", func(t *testing.T) {
+		l, err := c.LRange("list", 1, -2)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b", "c"}, l)
+	})
+
+	t.Run("Range clamps out of range offsets", func(t *testing.T) {
+		l, _ := c.LRange("list", -10, 10)
+		assert.Equal(t, []string{"a", "b", "c", "d"}, l)
+
+		l, _ = c.LRange("list", 3, 1)
+		assert.Empty(t, l)
+	})
+
+	t.Run("Range of a missing key", func(t *testing.T) {
+		l, err := c.LRange("missing", 0, -1)
+		assert.NoError(t, err)
+		assert.Empty(t, l)
+	})
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// Loader fetches the value for k from the underlying data source on a cache
+// miss, along with the expiration to store it with, which has the same meaning
+// as in Set. It returns ErrNotFound (or an error wrapping it) if k doesn't
+// exist.
+type Loader func(k string) (any, time.Duration, error)
+
+// tombstone is stored in place of a value when the loader reported that the
+// key doesn't exist. Tombstones are invisible to every method other than
+// GetOrLoad.
+type tombstone struct{}
+
+// SetLoader sets the function used by GetOrLoad to fetch missing items. If
+// negativeTTL is positive, keys the loader reports as not found are remembered
+// for that duration, and GetOrLoad returns ErrNotFound for them without calling
+// the loader again. A negativeTTL of 0 disables this.
+func (c *Cache) SetLoader(l Loader, negativeTTL time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loader = l
+	c.negativeTTL = negativeTTL
+}
+
+// GetOrLoad returns the item stored under k. On a miss the value is fetched with
+// the cache's loader, stored, and returned. Returns ErrNotFound if k doesn't
+// exist in the cache or in the data source, and the loader's error if it
+// fails. The loader is called without holding the cache's lock, so concurrent
+// misses for the same key may each call it. If the key is set while the loader
+// runs, the loaded value is discarded and the value that was set is returned.
+func (c *Cache) GetOrLoad(k string) (any, error) {
+	c.mu.RLock()
+	item, found := c.items[k]
+	l := c.loader
+	c.mu.RUnlock()
+	if found && !item.Expired() {
+		if item.tombstone() {
+			return nil, ErrNotFound
+		}
+		return item.Object, nil
+	}
+	if l == nil {
+		return nil, ErrNotFound
+	}
+
+	x, d, err := l(k)
+	if errors.Is(err, ErrNotFound) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if _, found := c.lookup(k); !found && c.negativeTTL > 0 {
+			c.put(k, Item{
+				Object:     tombstone{},
+				Expiration: time.Now().Add(c.negativeTTL).UnixNano(),
+			})
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, found := c.lookup(k); found {
+		return item.Object, nil
+	}
+	c.put(k, Item{
+		Object:     x,
+		Expiration: c.expiration(d),
+	})
+	return x, nil
+}
+
+// IsNegative reports whether k holds an unexpired tombstone recording that the
+// loader couldn't find it. Get reports such keys as not found.
+func (c *Cache) IsNegative(k string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, found := c.items[k]
+	return found && !item.Expired() && item.tombstone()
+}
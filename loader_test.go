@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_GetOrLoad(t *testing.T) {
+	db := map[string]string{"key1": "value1"}
+	newLoader := func(calls *int) Loader {
+		return func(k string) (any, time.Duration, error) {
+			*calls++
+			if v, ok := db[k]; ok {
+				return v, NoExpiration, nil
+			}
+			return nil, 0, ErrNotFound
+		}
+	}
+
+	t.Run("Load and store a missing item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		calls := 0
+		c.SetLoader(newLoader(&calls), 0)
+
+		val, err := c.GetOrLoad("key1")
+		assert.NoError(t, err)
+		assert.Equal(t, "value1", val)
+		val, err = c.GetOrLoad("key1")
+		assert.NoError(t, err)
+		assert.Equal(t, "value1", val)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Remember keys the loader couldn't find", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		calls := 0
+		c.SetLoader(newLoader(&calls), time.Minute)
+
+		_, err := c.GetOrLoad("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = c.GetOrLoad("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, 1, calls)
+		assert.True(t, c.IsNegative("missing"))
+	})
+
+	t.Run("Call the loader again once the tombstone expires", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		calls := 0
+		c.SetLoader(newLoader(&calls), time.Millisecond)
+
+		_, _ = c.GetOrLoad("missing")
+		time.Sleep(2 * time.Millisecond)
+		_, _ = c.GetOrLoad("missing")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Don't remember misses without a negative TTL", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		calls := 0
+		c.SetLoader(newLoader(&calls), 0)
+
+		_, _ = c.GetOrLoad("missing")
+		_, _ = c.GetOrLoad("missing")
+		assert.Equal(t, 2, calls)
+		assert.False(t, c.IsNegative("missing"))
+	})
+
+	t.Run("Return loader errors without storing anything", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		errDown := errors.New("database down")
+		c.SetLoader(func(k string) (any, time.Duration, error) {
+			return nil, 0, errDown
+		}, time.Minute)
+
+		_, err := c.GetOrLoad("key1")
+		assert.ErrorIs(t, err, errDown)
+		assert.Equal(t, 0, c.ItemCount())
+	})
+
+	t.Run("Keep a value set while the loader runs", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		started, release := make(chan struct{}), make(chan struct{})
+		c.SetLoader(func(k string) (any, time.Duration, error) {
+			close(started)
+			<-release
+			return "stale", NoExpiration, nil
+		}, 0)
+
+		done := make(chan any)
+		go func() {
+			val, err := c.GetOrLoad("key1")
+			assert.NoError(t, err)
+			done <- val
+		}()
+		<-started
+		c.Set("key1", "fresh", NoExpiration)
+		close(release)
+
+		assert.Equal(t, "fresh", <-done)
+		val, _ := c.Get("key1")
+		assert.Equal(t, "fresh", val)
+	})
+
+	t.Run("Without a loader", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, err := c.GetOrLoad("key1")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestCache_Tombstones(t *testing.T) {
+	newCache := func() *Cache {
+		c := New(DefaultExpiration, 0)
+		c.SetLoader(func(k string) (any, time.Duration, error) {
+			return nil, 0, ErrNotFound
+		}, time.Minute)
+		_, _ = c.GetOrLoad("missing")
+		return c
+	}
+
+	t.Run("Tombstones look missing", func(t *testing.T) {
+		c := newCache()
+		c.Set("key1", "value1", NoExpiration)
+
+		val, found := c.Get("missing")
+		assert.False(t, found)
+		assert.Nil(t, val)
+		assert.Equal(t, map[string]any{"key1": "value1"}, itemObjects(c.Items()))
+		assert.NoError(t, c.Add("missing", "value", NoExpiration))
+		assert.False(t, c.IsNegative("missing"))
+	})
+
+	t.Run("Tombstones don't call OnEvicted", func(t *testing.T) {
+		c := newCache()
+		evicted := false
+		c.OnEvicted(func(k string, v any) {
+			evicted = true
+		})
+
+		c.Delete("missing")
+		assert.False(t, evicted)
+	})
+
+	t.Run("Tombstones are not saved", func(t *testing.T) {
+		c := newCache()
+		c.Set("key1", "value1", NoExpiration)
+
+		var buf bytes.Buffer
+		assert.NoError(t, c.Save(&buf))
+		loaded := New(DefaultExpiration, 0)
+		assert.NoError(t, loaded.Load(&buf))
+		assert.Equal(t, 1, loaded.ItemCount())
+	})
+}
+
+func itemObjects(items map[string]Item) map[string]any {
+	m := make(map[string]any, len(items))
+	for k, v := range items {
+		m[k] = v.Object
+	}
+	return m
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Number is the set of types that Add and Sub operate on, including named
+// types such as time.Duration.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Add atomically adds delta to the item stored under k, applying the cache's
+// overflow policy. Returns an error if the item was not found, or if its value
+// is not of type T. If there is no error, the new value is returned. All the
+// typed increment methods, e.g. IncrementInt64, are built on Add.
+func Add[T Number](c *Cache, k string, delta T) (T, error) {
+	return modifyNumber(c, k, delta, addNumber[T])
+}
+
+// Sub atomically subtracts delta from the item stored under k. See Add. All the
+// typed decrement methods, e.g. DecrementInt64, are built on Sub.
+func Sub[T Number](c *Cache, k string, delta T) (T, error) {
+	return modifyNumber(c, k, delta, subNumber[T])
+}
+
+// AddOrInit atomically adds delta to the item stored under k, like Add. If the
+// item doesn't exist or has expired, it is created with the value
+// initial + delta and the expiration d, with the same meaning as in Set.
+func AddOrInit[T Number](c *Cache, k string, delta, initial T, d time.Duration) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var val T
+	v, found := c.lookup(k)
+	if !found {
+		val = initial
+		v = Item{Expiration: c.expiration(d)}
+	} else if old, ok := v.Object.(T); ok {
+		val = old
+	} else {
+		return 0, fmt.Errorf("The value for %s does not have type %T", k, val)
+	}
+	return storeNumber(c, k, v, val, delta, addNumber[T])
+}
+
+// modify atomically replaces the value of the item stored under k with the
+// result of f. Returns an error if the item was not found or if f fails.
+func (c *Cache) modify(k string, f func(any) (any, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, found := c.lookup(k)
+	if !found {
+		return fmt.Errorf("Item %s not found", k)
+	}
+	newValue, err := f(v.Object)
+	if err != nil {
+		return err
+	}
+	v.Object = newValue
+	c.write(k, v)
+	return nil
+}
+
+func modifyNumber[T Number](c *Cache, k string, delta T, op func(a, b T, p OverflowPolicy) (T, error)) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, found := c.lookup(k)
+	if !found {
+		return 0, fmt.Errorf("Item %s not found", k)
+	}
+	val, ok := v.Object.(T)
+	if !ok {
+		return 0, fmt.Errorf("The value for %s does not have type %T", k, val)
+	}
+	return storeNumber(c, k, v, val, delta, op)
+}
+
+// storeNumber applies op to val and delta and writes the result into v. The
+// caller must hold c.mu.
+func storeNumber[T Number](c *Cache, k string, v Item, val, delta T, op func(a, b T, p OverflowPolicy) (T, error)) (T, error) {
+	newValue, err := op(val, delta, c.overflow)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", err, k)
+	}
+	v.Object = newValue
+	c.write(k, v)
+	return newValue, nil
+}
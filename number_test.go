@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type score int32
+
+func TestAdd(t *testing.T) {
+	t.Run("Add to a time.Duration", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", time.Second, NoExpiration)
+
+		newVal, err := Add(c, "key", 500*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, 1500*time.Millisecond, newVal)
+
+		val, _ := c.Get("key")
+		assert.Equal(t, 1500*time.Millisecond, val)
+	})
+
+	t.Run("Add to a named integer type", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.SetOverflowPolicy(OverflowSaturate)
+		c.Set("key", score(2147483600), NoExpiration)
+
+		newVal, err := Add(c, "key", score(100))
+		assert.NoError(t, err)
+		assert.Equal(t, score(2147483647), newVal)
+	})
+
+	t.Run("Add to an item of another type", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", int64(1), NoExpiration)
+
+		_, err := Add(c, "key", 1)
+		assert.Error(t, err)
+
+		val, _ := c.Get("key")
+		assert.Equal(t, int64(1), val)
+	})
+
+	t.Run("Add to a missing item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, err := Add(c, "key", 1)
+		assert.Error(t, err)
+	})
+}
+
+func TestSub(t *testing.T) {
+	t.Run("Subtract from a time.Duration", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", time.Second, NoExpiration)
+
+		newVal, err := Sub(c, "key", 250*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Equal(t, 750*time.Millisecond, newVal)
+	})
+}
+
+func TestAddOrInit(t *testing.T) {
+	t.Run("Create then add to a time.Duration", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+
+		newVal, err := AddOrInit(c, "key", time.Second, time.Minute, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Minute+time.Second, newVal)
+
+		newVal, err = AddOrInit(c, "key", time.Second, time.Minute, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Minute+2*time.Second, newVal)
+	})
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"math"
+	"unsafe"
+)
+
+// OverflowPolicy controls what the increment and decrement methods, e.g.
+// Increment, IncrementUint8 or DecrementUint, do when the result doesn't fit
+// in the item's type.
+type OverflowPolicy int
+
+const (
+	// OverflowWrap lets the result wrap around, as Go arithmetic does. This is
+	// the default.
+	OverflowWrap OverflowPolicy = iota
+	// OverflowError leaves the item unchanged and returns an error wrapping
+	// ErrOverflow.
+	OverflowError
+	// OverflowSaturate clamps the result at the minimum or maximum value of the
+	// item's type.
+	OverflowSaturate
+)
+
+// SetOverflowPolicy sets the overflow policy used by the increment and
+// decrement methods of the cache.
+func (c *Cache) SetOverflowPolicy(p OverflowPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.overflow = p
+}
+
+// addNumber adds b to a, applying the overflow policy p.
+func addNumber[T Number](a, b T, p OverflowPolicy) (T, error) {
+	s := a + b
+	switch {
+	case isFloat[T]():
+		if math.IsInf(float64(s), 0) && !math.IsInf(float64(a), 0) && !math.IsInf(float64(b), 0) {
+			return overflowed(s, s > 0, p)
+		}
+	case isSigned[T]():
+		if (b > 0 && s < a) || (b < 0 && s > a) {
+			return overflowed(s, b > 0, p)
+		}
+	default:
+		if s < a {
+			return overflowed(s, true, p)
+		}
+	}
+	return s, nil
+}
+
+// subNumber subtracts b from a, applying the overflow policy p.
+func subNumber[T Number](a, b T, p OverflowPolicy) (T, error) {
+	s := a - b
+	switch {
+	case isFloat[T]():
+		if math.IsInf(float64(s), 0) && !math.IsInf(float64(a), 0) && !math.IsInf(float64(b), 0) {
+			return overflowed(s, s > 0, p)
+		}
+	case isSigned[T]():
+		if (b > 0 && s > a) || (b < 0 && s < a) {
+			return overflowed(s, b < 0, p)
+		}
+	default:
+		if b > a {
+			return overflowed(s, false, p)
+		}
+	}
+	return s, nil
+}
+
+// offsetValue adds n to val, or subtracts it if sub is set, applying the
+// overflow policy p, for the values Increment and Decrement accept. Unlike
+// with addNumber, n may not fit in the type of val, and may be negative for an
+// unsigned val. ok is false if val is not a number.
+func offsetValue(val any, n int64, sub bool, p OverflowPolicy) (x any, ok bool, err error) {
+	switch val := val.(type) {
+	case int:
+		x, err = offsetNumber(val, n, sub, p)
+	case int8:
+		x, err = offsetNumber(val, n, sub, p)
+	case int16:
+		x, err = offsetNumber(val, n, sub, p)
+	case int32:
+		x, err = offsetNumber(val, n, sub, p)
+	case int64:
+		x, err = offsetNumber(val, n, sub, p)
+	case uint:
+		x, err = offsetNumber(val, n, sub, p)
+	case uintptr:
+		x, err = offsetNumber(val, n, sub, p)
+	case uint8:
+		x, err = offsetNumber(val, n, sub, p)
+	case uint16:
+		x, err = offsetNumber(val, n, sub, p)
+	case uint32:
+		x, err = offsetNumber(val, n, sub, p)
+	case uint64:
+		x, err = offsetNumber(val, n, sub, p)
+	case float32:
+		x, err = offsetNumber(val, n, sub, p)
+	case float64:
+		x, err = offsetNumber(val, n, sub, p)
+	default:
+		return nil, false, nil
+	}
+	return x, true, err
+}
+
+// offsetFloat adds n to val, or subtracts it if sub is set, applying the
+// overflow policy p, for the values IncrementFloat and DecrementFloat accept.
+// ok is false if val is not a float32 or float64.
+func offsetFloat(val any, n float64, sub bool, p OverflowPolicy) (x any, ok bool, err error) {
+	switch val := val.(type) {
+	case float32:
+		x, err = offsetFloatNumber(val, float32(n), sub, p)
+	case float64:
+		x, err = offsetFloatNumber(val, n, sub, p)
+	default:
+		return nil, false, nil
+	}
+	return x, true, err
+}
+
+// offsetFloatNumber adds n to val, or subtracts it if sub is set, applying the
+// overflow policy p.
+func offsetFloatNumber[T float32 | float64](val, n T, sub bool, p OverflowPolicy) (T, error) {
+	if sub {
+		return subNumber(val, n, p)
+	}
+	return addNumber(val, n, p)
+}
+
+// offsetNumber adds n to val, or subtracts it if sub is set, applying the
+// overflow policy p. With OverflowWrap, the result is the same as with Go
+// arithmetic on n converted to T.
+func offsetNumber[T Number](val T, n int64, sub bool, p OverflowPolicy) (T, error) {
+	wrapped := val + T(n)
+	if sub {
+		wrapped = val - T(n)
+	}
+	switch {
+	case isFloat[T]():
+		if sub {
+			return subNumber(val, T(n), p)
+		}
+		return addNumber(val, T(n), p)
+	case p == OverflowWrap:
+		return wrapped, nil
+	case isSigned[T]():
+		// Compute in int64, then check that the result fits in T.
+		r, err := addNumber(int64(val), n, OverflowError)
+		if sub {
+			r, err = subNumber(int64(val), n, OverflowError)
+		}
+		up := (n > 0) != sub
+		if err != nil || r > int64(maxNumber[T]()) || r < int64(minNumber[T]()) {
+			return overflowed(wrapped, up, p)
+		}
+		return T(r), nil
+	}
+	// Add or subtract the magnitude of n, which fits in a uint64 even for
+	// math.MinInt64.
+	m := uint64(n)
+	if n < 0 {
+		m = -m
+	}
+	v := uint64(val)
+	if up := (n >= 0) != sub; up {
+		if m > uint64(maxNumber[T]())-v {
+			return overflowed(wrapped, true, p)
+		}
+		return T(v + m), nil
+	}
+	if m > v {
+		return overflowed(wrapped, false, p)
+	}
+	return T(v - m), nil
+}
+
+// overflowed returns the result of an operation that overflowed upwards (up)
+// or downwards, according to the overflow policy p.
+func overflowed[T Number](wrapped T, up bool, p OverflowPolicy) (T, error) {
+	switch p {
+	case OverflowError:
+		return 0, ErrOverflow
+	case OverflowSaturate:
+		if up {
+			return maxNumber[T](), nil
+		}
+		return minNumber[T](), nil
+	}
+	return wrapped, nil
+}
+
+func isFloat[T Number]() bool {
+	var half T = 1
+	half /= 2
+	return half != 0
+}
+
+func isSigned[T Number]() bool {
+	var zero T
+	return zero-1 < 0
+}
+
+func maxNumber[T Number]() T {
+	var zero T
+	switch {
+	case isFloat[T]():
+		max := math.MaxFloat64
+		if unsafe.Sizeof(zero) == 4 {
+			max = math.MaxFloat32
+		}
+		return T(max)
+	case isSigned[T]():
+		// Double until the next doubling would overflow, then fill the lower bits.
+		x := T(1)
+		for x*2 > x {
+			x *= 2
+		}
+		return x + (x - 1)
+	default:
+		return zero - 1
+	}
+}
+
+func minNumber[T Number]() T {
+	switch {
+	case isFloat[T]():
+		return -maxNumber[T]()
+	case isSigned[T]():
+		return -maxNumber[T]() - 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_SetOverflowPolicy(t *testing.T) {
+	t.Run("Wrap around by default", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", uint(0), NoExpiration)
+		newVal, err := c.DecrementUint("key", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(math.MaxUint), newVal)
+	})
+
+	t.Run("Return ErrOverflow and leave the item unchanged", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.SetOverflowPolicy(OverflowError)
+		c.Set("key", uint8(250), NoExpiration)
+
+		_, err := c.IncrementUint8("key", 10)
+		assert.ErrorIs(t, err, ErrOverflow)
+
+		val, _ := c.Get("key")
+		assert.Equal(t, uint8(250), val)
+
+		c.Set("key", uint(3), NoExpiration)
+		_, err = c.DecrementUint("key", 4)
+		assert.ErrorIs(t, err, ErrOverflow)
+
+		c.Set("key", int8(-128), NoExpiration)
+		_, err = c.DecrementInt8("key", 1)
+		assert.ErrorIs(t, err, ErrOverflow)
+
+		newVal, err := c.DecrementInt8("key", -1)
+		assert.NoError(t, err)
+		assert.Equal(t, int8(-127), newVal)
+	})
+
+	t.Run("Saturate at the bounds of the type", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.SetOverflowPolicy(OverflowSaturate)
+
+		c.Set("key", uint8(250), NoExpiration)
+		u8, err := c.IncrementUint8("key", 10)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(math.MaxUint8), u8)
+
+		c.Set("key", uint64(3), NoExpiration)
+		u64, err := c.DecrementUint64("key", 4)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), u64)
+
+		c.Set("key", int16(math.MinInt16+1), NoExpiration)
+		i16, err := c.DecrementInt16("key", 5)
+		assert.NoError(t, err)
+		assert.Equal(t, int16(math.MinInt16), i16)
+
+		c.Set("key", int64(math.MaxInt64-1), NoExpiration)
+		i64, err := c.DecrementInt64("key", -5)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(math.MaxInt64), i64)
+
+		c.Set("key", float32(math.MaxFloat32), NoExpiration)
+		f32, err := c.IncrementFloat32("key", math.MaxFloat32)
+		assert.NoError(t, err)
+		assert.Equal(t, float32(math.MaxFloat32), f32)
+	})
+
+	t.Run("Apply the policy to IncrementOrInit", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.SetOverflowPolicy(OverflowError)
+		c.Set("key", uint64(math.MaxUint64), NoExpiration)
+
+		_, err := c.IncrementOrInitUint64("key", 1, 0, NoExpiration)
+		assert.ErrorIs(t, err, ErrOverflow)
+	})
+}
+
+func TestCache_SetOverflowPolicy_Increment(t *testing.T) {
+	t.Run("Return ErrOverflow from Increment and Decrement", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.SetOverflowPolicy(OverflowError)
+
+		c.Set("key", uint(0), NoExpiration)
+		assert.ErrorIs(t, c.Decrement("key", 1), ErrOverflow)
+		val, _ := c.Get("key")
+		assert.Equal(t, uint(0), val)
+
+		c.Set("key", int8(100), NoExpiration)
+		assert.ErrorIs(t, c.Increment("key", 28), ErrOverflow)
+		assert.ErrorIs(t, c.Increment("key", 1000), ErrOverflow)
+		assert.NoError(t, c.Increment("key", 27))
+		val, _ = c.Get("key")
+		assert.Equal(t, int8(127), val)
+
+		c.Set("key", uint8(10), NoExpiration)
+		assert.NoError(t, c.Increment("key", -10))
+		assert.ErrorIs(t, c.Decrement("key", -256), ErrOverflow)
+		val, _ = c.Get("key")
+		assert.Equal(t, uint8(0), val)
+
+		c.Set("key", int64(math.MinInt64), NoExpiration)
+		assert.ErrorIs(t, c.Decrement("key", 1), ErrOverflow)
+
+		c.Set("key", float64(math.MaxFloat64), NoExpiration)
+		assert.ErrorIs(t, c.IncrementFloat("key", math.MaxFloat64), ErrOverflow)
+		assert.ErrorIs(t, c.DecrementFloat("key", -math.MaxFloat64), ErrOverflow)
+		val, _ = c.Get("key")
+		assert.Equal(t, float64(math.MaxFloat64), val)
+	})
+
+	t.Run("Saturate in Increment and Decrement", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.SetOverflowPolicy(OverflowSaturate)
+
+		c.Set("key", uint(3), NoExpiration)
+		assert.NoError(t, c.Decrement("key", 4))
+		val, _ := c.Get("key")
+		assert.Equal(t, uint(0), val)
+
+		c.Set("key", int16(math.MaxInt16-1), NoExpiration)
+		assert.NoError(t, c.Increment("key", math.MaxInt64))
+		val, _ = c.Get("key")
+		assert.Equal(t, int16(math.MaxInt16), val)
+
+		c.Set("key", uint32(5), NoExpiration)
+		assert.NoError(t, c.Increment("key", math.MinInt64))
+		val, _ = c.Get("key")
+		assert.Equal(t, uint32(0), val)
+
+		c.Set("key", float32(-math.MaxFloat32), NoExpiration)
+		assert.NoError(t, c.DecrementFloat("key", math.MaxFloat32))
+		val, _ = c.Get("key")
+		assert.Equal(t, float32(-math.MaxFloat32), val)
+	})
+
+	t.Run("Wrap around in Increment and Decrement by default", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", uint(0), NoExpiration)
+		assert.NoError(t, c.Decrement("key", 1))
+		val, _ := c.Get("key")
+		assert.Equal(t, uint(math.MaxUint), val)
+	})
+
+	t.Run("Set the policy of every shard", func(t *testing.T) {
+		sc := newShardedCache(4, DefaultExpiration)
+		sc.SetOverflowPolicy(OverflowError)
+		for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			sc.Set(k, uint8(255), NoExpiration)
+			assert.ErrorIs(t, sc.Increment(k, 1), ErrOverflow)
+		}
+	})
+}
+
+func TestOverflowArithmetic(t *testing.T) {
+	t.Run("Signed bounds", func(t *testing.T) {
+		assert.Equal(t, int8(math.MaxInt8), maxNumber[int8]())
+		assert.Equal(t, int8(math.MinInt8), minNumber[int8]())
+		assert.Equal(t, int64(math.MaxInt64), maxNumber[int64]())
+		assert.Equal(t, int64(math.MinInt64), minNumber[int64]())
+	})
+
+	t.Run("Unsigned and float bounds", func(t *testing.T) {
+		assert.Equal(t, uint32(math.MaxUint32), maxNumber[uint32]())
+		assert.Equal(t, uint32(0), minNumber[uint32]())
+		assert.Equal(t, float32(math.MaxFloat32), maxNumber[float32]())
+		assert.Equal(t, -math.MaxFloat64, minNumber[float64]())
+	})
+
+	t.Run("No overflow near the bounds", func(t *testing.T) {
+		s, err := addNumber(int8(100), int8(27), OverflowError)
+		assert.NoError(t, err)
+		assert.Equal(t, int8(127), s)
+
+		u, err := subNumber(uint16(5), uint16(5), OverflowError)
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(0), u)
+
+		f, err := addNumber(math.Inf(1), 1, OverflowError)
+		assert.NoError(t, err)
+		assert.True(t, math.IsInf(f, 1))
+	})
+}
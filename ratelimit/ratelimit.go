@@ -0,0 +1,230 @@
+// Package ratelimit provides rate limiters keyed by string that keep their
+// state in a go-cache Cache or ShardedCache. Every limiter stores its state
+// with an expiration, so the state of idle keys is removed by the cache's
+// janitor.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Backend is the part of cache.Cache and cache.ShardedCache used by the
+// limiters to update their state atomically.
+type Backend interface {
+	Update(k string, f func(old any, found bool) (any, time.Duration, bool))
+}
+
+// Limiter decides whether a request for a key is allowed. It returns whether
+// the request is allowed, how many more requests would be allowed right now,
+// and, when the request is denied, how long to wait before retrying.
+type Limiter interface {
+	Allow(key string) (allowed bool, remaining int, retryAfter time.Duration)
+}
+
+// FixedWindow allows up to limit requests per key in consecutive windows of a
+// fixed length, starting at the first request of each window.
+type FixedWindow struct {
+	backend Backend
+	limit   int
+	window  time.Duration
+	now     func() time.Time
+}
+
+type fixedWindowState struct {
+	Start time.Time
+	Count int
+}
+
+// NewFixedWindow returns a fixed-window limiter allowing limit requests per
+// window. It panics if limit or window is not positive.
+func NewFixedWindow(backend Backend, limit int, window time.Duration) *FixedWindow {
+	checkPositive("NewFixedWindow", "limit", limit, "window", window)
+	return &FixedWindow{backend: backend, limit: limit, window: window, now: time.Now}
+}
+
+// Allow implements Limiter.
+func (l *FixedWindow) Allow(key string) (allowed bool, remaining int, retryAfter time.Duration) {
+	now := l.now()
+	l.backend.Update(key, func(old any, found bool) (any, time.Duration, bool) {
+		s, ok := old.(fixedWindowState)
+		if !ok || now.Sub(s.Start) >= l.window {
+			s = fixedWindowState{Start: now}
+		}
+		ttl := s.Start.Add(l.window).Sub(now)
+		if s.Count >= l.limit {
+			retryAfter = ttl
+			return s, ttl, true
+		}
+		s.Count++
+		allowed, remaining = true, l.limit-s.Count
+		return s, ttl, true
+	})
+	return allowed, remaining, retryAfter
+}
+
+// SlidingWindowLog allows up to limit requests per key in any window of the
+// given length, by remembering the time of every allowed request. It is exact,
+// but uses memory proportional to limit for every key.
+type SlidingWindowLog struct {
+	backend Backend
+	limit   int
+	window  time.Duration
+	now     func() time.Time
+}
+
+// NewSlidingWindowLog returns a sliding-window-log limiter allowing limit
+// requests per window. It panics if limit or window is not positive.
+func NewSlidingWindowLog(backend Backend, limit int, window time.Duration) *SlidingWindowLog {
+	checkPositive("NewSlidingWindowLog", "limit", limit, "window", window)
+	return &SlidingWindowLog{backend: backend, limit: limit, window: window, now: time.Now}
+}
+
+// Allow implements Limiter.
+func (l *SlidingWindowLog) Allow(key string) (allowed bool, remaining int, retryAfter time.Duration) {
+	now := l.now()
+	l.backend.Update(key, func(old any, found bool) (any, time.Duration, bool) {
+		log, _ := old.([]time.Time)
+		// Copy the requests still inside the window, since the old slice may
+		// be held by callers of Items.
+		kept := make([]time.Time, 0, len(log)+1)
+		for _, t := range log {
+			if now.Sub(t) < l.window {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) >= l.limit {
+			retryAfter = kept[0].Add(l.window).Sub(now)
+			return kept, kept[len(kept)-1].Add(l.window).Sub(now), true
+		}
+		kept = append(kept, now)
+		allowed, remaining = true, l.limit-len(kept)
+		return kept, l.window, true
+	})
+	return allowed, remaining, retryAfter
+}
+
+// SlidingWindowCounter approximates a sliding window by weighting the count
+// of the previous fixed window by how much of it still overlaps the sliding
+// window. It uses constant memory per key.
+type SlidingWindowCounter struct {
+	backend Backend
+	limit   int
+	window  time.Duration
+	now     func() time.Time
+}
+
+type slidingWindowCounterState struct {
+	Start    time.Time
+	Current  int
+	Previous int
+}
+
+// NewSlidingWindowCounter returns a sliding-window-counter limiter allowing
+// about limit requests per window. It panics if limit or window is not
+// positive.
+func NewSlidingWindowCounter(backend Backend, limit int, window time.Duration) *SlidingWindowCounter {
+	checkPositive("NewSlidingWindowCounter", "limit", limit, "window", window)
+	return &SlidingWindowCounter{backend: backend, limit: limit, window: window, now: time.Now}
+}
+
+// Allow implements Limiter.
+func (l *SlidingWindowCounter) Allow(key string) (allowed bool, remaining int, retryAfter time.Duration) {
+	now := l.now()
+	l.backend.Update(key, func(old any, found bool) (any, time.Duration, bool) {
+		s, ok := old.(slidingWindowCounterState)
+		if !ok {
+			s = slidingWindowCounterState{Start: now.Truncate(l.window)}
+		}
+		switch elapsed := now.Sub(s.Start); {
+		case elapsed >= 2*l.window:
+			s = slidingWindowCounterState{Start: now.Truncate(l.window)}
+		case elapsed >= l.window:
+			s = slidingWindowCounterState{Start: s.Start.Add(l.window), Previous: s.Current}
+		}
+		weight := 1 - float64(now.Sub(s.Start))/float64(l.window)
+		count := int(math.Floor(float64(s.Previous)*weight)) + s.Current
+		ttl := s.Start.Add(2 * l.window).Sub(now)
+		if count >= l.limit {
+			retryAfter = l.retryAfter(s, now)
+			return s, ttl, true
+		}
+		s.Current++
+		allowed, remaining = true, l.limit-count-1
+		return s, ttl, true
+	})
+	return allowed, remaining, retryAfter
+}
+
+// retryAfter returns how long until the weighted count drops below the limit,
+// assuming no further requests are allowed in the meantime.
+func (l *SlidingWindowCounter) retryAfter(s slidingWindowCounterState, now time.Time) time.Duration {
+	if s.Current >= l.limit || s.Previous == 0 {
+		return s.Start.Add(l.window).Sub(now)
+	}
+	// Solve floor(Previous * (1 - t/window)) + Current < limit for t.
+	allowedPrevious := float64(l.limit - s.Current - 1)
+	t := time.Duration((1 - (allowedPrevious+1)/float64(s.Previous)) * float64(l.window))
+	if wait := s.Start.Add(t).Sub(now); wait > 0 {
+		return wait
+	}
+	return time.Nanosecond
+}
+
+// TokenBucket allows bursts of up to capacity requests per key, refilling one
+// token every interval.
+type TokenBucket struct {
+	backend  Backend
+	capacity int
+	interval time.Duration
+	now      func() time.Time
+}
+
+type tokenBucketState struct {
+	Tokens float64
+	Last   time.Time
+}
+
+// NewTokenBucket returns a token-bucket limiter holding up to capacity tokens
+// and adding one token every interval. It panics if capacity or interval is
+// not positive.
+func NewTokenBucket(backend Backend, capacity int, interval time.Duration) *TokenBucket {
+	checkPositive("NewTokenBucket", "capacity", capacity, "interval", interval)
+	return &TokenBucket{backend: backend, capacity: capacity, interval: interval, now: time.Now}
+}
+
+// Allow implements Limiter.
+func (l *TokenBucket) Allow(key string) (allowed bool, remaining int, retryAfter time.Duration) {
+	now := l.now()
+	l.backend.Update(key, func(old any, found bool) (any, time.Duration, bool) {
+		s, ok := old.(tokenBucketState)
+		if !ok {
+			s = tokenBucketState{Tokens: float64(l.capacity), Last: now}
+		}
+		s.Tokens = math.Min(float64(l.capacity), s.Tokens+float64(now.Sub(s.Last))/float64(l.interval))
+		s.Last = now
+		if s.Tokens < 1 {
+			retryAfter = time.Duration((1 - s.Tokens) * float64(l.interval))
+		} else {
+			s.Tokens--
+			allowed = true
+		}
+		remaining = int(s.Tokens)
+		// Once the bucket is full again its state is the same as a new one's,
+		// so it can expire.
+		return s, time.Duration((float64(l.capacity) - s.Tokens) * float64(l.interval)), true
+	})
+	return allowed, remaining, retryAfter
+}
+
+// checkPositive panics if the count or the duration passed to the constructor
+// fn is not positive, since no limiter can work with them.
+func checkPositive(fn, countName string, count int, durationName string, d time.Duration) {
+	if count <= 0 {
+		panic(fmt.Sprintf("ratelimit: non-positive %s %d for %s", countName, count, fn))
+	}
+	if d <= 0 {
+		panic(fmt.Sprintf("ratelimit: non-positive %s %v for %s", durationName, d, fn))
+	}
+}
@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pzentenoe/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newClock() *clock {
+	return &clock{t: time.Date(2024, 7, 3, 12, 0, 0, 0, time.UTC)}
+}
+
+func TestFixedWindow_Allow(t *testing.T) {
+	t.Run("Allow up to the limit per window", func(t *testing.T) {
+		clk := newClock()
+		l := NewFixedWindow(cache.New(cache.NoExpiration, 0), 2, time.Minute)
+		l.now = clk.now
+
+		allowed, remaining, _ := l.Allow("user")
+		assert.True(t, allowed)
+		assert.Equal(t, 1, remaining)
+
+		allowed, remaining, _ = l.Allow("user")
+		assert.True(t, allowed)
+		assert.Equal(t, 0, remaining)
+
+		clk.advance(20 * time.Second)
+		allowed, remaining, retryAfter := l.Allow("user")
+		assert.False(t, allowed)
+		assert.Equal(t, 0, remaining)
+		assert.Equal(t, 40*time.Second, retryAfter)
+
+		allowed, _, _ = l.Allow("other")
+		assert.True(t, allowed)
+
+		clk.advance(40 * time.Second)
+		allowed, _, _ = l.Allow("user")
+		assert.True(t, allowed)
+	})
+
+	t.Run("Idle keys expire from the cache", func(t *testing.T) {
+		c := cache.New(cache.NoExpiration, 0)
+		l := NewFixedWindow(c, 2, 10*time.Millisecond)
+		l.Allow("user")
+		assert.Equal(t, 1, c.ItemCount())
+
+		time.Sleep(20 * time.Millisecond)
+		c.DeleteExpired()
+		assert.Equal(t, 0, c.ItemCount())
+	})
+}
+
+func TestSlidingWindowLog_Allow(t *testing.T) {
+	t.Run("Allow up to the limit in any window", func(t *testing.T) {
+		clk := newClock()
+		l := NewSlidingWindowLog(cache.New(cache.NoExpiration, 0), 2, time.Minute)
+		l.now = clk.now
+
+		allowed, _, _ := l.Allow("user")
+		assert.True(t, allowed)
+		clk.advance(30 * time.Second)
+		allowed, remaining, _ := l.Allow("user")
+		assert.True(t, allowed)
+		assert.Equal(t, 0, remaining)
+
+		clk.advance(20 * time.Second)
+		allowed, _, retryAfter := l.Allow("user")
+		assert.False(t, allowed)
+		assert.Equal(t, 10*time.Second, retryAfter)
+
+		clk.advance(10 * time.Second)
+		allowed, remaining, _ = l.Allow("user")
+		assert.True(t, allowed)
+		assert.Equal(t, 0, remaining)
+	})
+}
+
+func TestSlidingWindowCounter_Allow(t *testing.T) {
+	t.Run("Weight the previous window", func(t *testing.T) {
+		clk := newClock()
+		l := NewSlidingWindowCounter(cache.New(cache.NoExpiration, 0), 10, time.Minute)
+		l.now = clk.now
+
+		for i := 0; i < 10; i++ {
+			allowed, _, _ := l.Allow("user")
+			assert.True(t, allowed)
+		}
+		allowed, _, _ := l.Allow("user")
+		assert.False(t, allowed)
+
+		// Half-way into the next window, half of the previous count remains.
+		clk.advance(90 * time.Second)
+		for i := 0; i < 5; i++ {
+			allowed, _, _ := l.Allow("user")
+			assert.True(t, allowed)
+		}
+		allowed, _, retryAfter := l.Allow("user")
+		assert.False(t, allowed)
+		assert.Greater(t, retryAfter, time.Duration(0))
+
+		clk.advance(retryAfter)
+		allowed, _, _ = l.Allow("user")
+		assert.True(t, allowed)
+	})
+
+	t.Run("Reset after two idle windows", func(t *testing.T) {
+		clk := newClock()
+		l := NewSlidingWindowCounter(cache.New(cache.NoExpiration, 0), 1, time.Minute)
+		l.now = clk.now
+
+		allowed, _, _ := l.Allow("user")
+		assert.True(t, allowed)
+		clk.advance(3 * time.Minute)
+		allowed, _, _ = l.Allow("user")
+		assert.True(t, allowed)
+	})
+}
+
+func TestTokenBucket_Allow(t *testing.T) {
+	t.Run("Allow bursts and refill over time", func(t *testing.T) {
+		clk := newClock()
+		l := NewTokenBucket(cache.New(cache.NoExpiration, 0), 3, time.Second)
+		l.now = clk.now
+
+		for i := 2; i >= 0; i-- {
+			allowed, remaining, _ := l.Allow("user")
+			assert.True(t, allowed)
+			assert.Equal(t, i, remaining)
+		}
+		allowed, _, retryAfter := l.Allow("user")
+		assert.False(t, allowed)
+		assert.Equal(t, time.Second, retryAfter)
+
+		clk.advance(500 * time.Millisecond)
+		allowed, _, retryAfter = l.Allow("user")
+		assert.False(t, allowed)
+		assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+		clk.advance(500 * time.Millisecond)
+		allowed, remaining, _ := l.Allow("user")
+		assert.True(t, allowed)
+		assert.Equal(t, 0, remaining)
+	})
+
+	t.Run("Full buckets expire from the cache", func(t *testing.T) {
+		c := cache.New(cache.NoExpiration, 0)
+		l := NewTokenBucket(c, 1, 10*time.Millisecond)
+		l.Allow("user")
+		assert.Equal(t, 1, c.ItemCount())
+
+		time.Sleep(20 * time.Millisecond)
+		c.DeleteExpired()
+		assert.Equal(t, 0, c.ItemCount())
+	})
+}
+
+func TestNew(t *testing.T) {
+	backend := cache.New(cache.NoExpiration, 0)
+	constructors := map[string]func(int, time.Duration){
+		"NewFixedWindow":          func(n int, d time.Duration) { NewFixedWindow(backend, n, d) },
+		"NewSlidingWindowLog":     func(n int, d time.Duration) { NewSlidingWindowLog(backend, n, d) },
+		"NewSlidingWindowCounter": func(n int, d time.Duration) { NewSlidingWindowCounter(backend, n, d) },
+		"NewTokenBucket":          func(n int, d time.Duration) { NewTokenBucket(backend, n, d) },
+	}
+	for name, f := range constructors {
+		t.Run(name+" rejects non-positive arguments", func(t *testing.T) {
+			assert.Panics(t, func() { f(0, time.Second) })
+			assert.Panics(t, func() { f(-1, time.Second) })
+			assert.Panics(t, func() { f(1, 0) })
+			assert.Panics(t, func() { f(1, -time.Second) })
+			assert.NotPanics(t, func() { f(1, time.Nanosecond) })
+		})
+	}
+}
+
+func TestBackend(t *testing.T) {
+	t.Run("Cache and ShardedCache are backends", func(t *testing.T) {
+		var _ Backend = (*cache.Cache)(nil)
+		var _ Backend = cache.ShardedCache(nil)
+	})
+}
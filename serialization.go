@@ -1,59 +1,473 @@
 package cache
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"math"
 	"os"
+	"time"
 )
 
-// Save Write the cache's items (using Gob) to an io.Writer.
-func (c *Cache) Save(w io.Writer) (err error) {
-	enc := gob.NewEncoder(w)
+// snapshotMagic starts every snapshot written by Save. Legacy snapshots are a
+// bare Gob-encoded map[string]Item, which can't start with these bytes.
+var snapshotMagic = [8]byte{'G', 'O', 'C', 'A', 'C', 'H', 'E', 0}
+
+// snapshotVersion is the version of the snapshot format written by Save.
+//
+// A snapshot is the magic bytes, followed by a header with the version,
+// creation time, default expiration, the name of the Codec that encoded the
+// items, the name of the Compression, or an empty name, and a flags byte. If
+// the encrypted flag is set, the header ends with the key ID and a random
+// salt. After the header come one frame per item, a frame of length 0, the
+// item count and a CRC-32C of everything before it. A frame is the uvarint
+// length of whatever one call to the codec's ItemEncoder wrote, followed by
+// those bytes; with the Gob codec, all the items share one Gob stream, so a
+// type is described only once.
+//
+// If the snapshot is encrypted, everything after the header is encrypted as
+// described in encryption.go. The compression is applied before the
+// encryption, and the checksum covers the header and the uncompressed,
+// unencrypted data.
+//
+// Strings in the header are a one-byte length and the string. Fixed-size
+// fields are big-endian.
+const snapshotVersion = 1
+
+// flagEncrypted is set in the flags byte of encrypted snapshots.
+const flagEncrypted = 1
+
+// saveChunkSize is the number of items Save encodes before releasing the
+// cache's lock to write them out.
+const saveChunkSize = 1024
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotRecord struct {
+	Key  string
+	Item Item
+}
+
+// SnapshotInfo describes a snapshot written by Save.
+type SnapshotInfo struct {
+	// Version is the snapshot format version, or 0 for legacy snapshots, which
+	// have no header.
+	Version           int
+	Created           time.Time
+	DefaultExpiration time.Duration
+	// Count is the number of items, or -1 if it can't be read without
+	// decrypting or decompressing the snapshot with a compression that isn't
+	// built in.
+	Count int
+	// Codec is the name of the codec the items were encoded with.
+	Codec string
+	// Compression is the name of the compression, or empty if the snapshot
+	// isn't compressed.
+	Compression string
+	Encrypted   bool
+	KeyID       string
+}
+
+// SaveOptions configures SaveWithOptions.
+type SaveOptions struct {
+	// Codec encodes the items. Defaults to GobCodec.
+	Codec Codec
+	// Compression, if set, compresses the items.
+	Compression Compression
+	// Key, if set, encrypts the items with AES-GCM. It must be 16, 24 or 32
+	// bytes long, to select AES-128, AES-192 or AES-256.
+	Key []byte
+	// KeyID is stored in the header of encrypted snapshots, so that the key
+	// can be found when loading them, e.g. after the key was rotated.
+	KeyID string
+}
+
+// LoadOptions configures LoadWithOptions.
+type LoadOptions struct {
+	// Codec decodes the items. Defaults to GobCodec.
+	Codec Codec
+	// Compressions are the compressions that can be used in addition to the
+	// built-in Gzip and Flate.
+	Compressions []Compression
+	// Keys maps key IDs to the keys used to decrypt encrypted snapshots.
+	Keys map[string][]byte
+	// Merge decides which item is kept when a loaded key already exists and
+	// hasn't expired. Defaults to KeepExisting.
+	Merge MergeStrategy
+	// Resolve, if set, is used instead of Merge, and returns the item to keep
+	// under k.
+	Resolve func(k string, existing, loaded Item) Item
+	// DropExpired skips loaded items that have already expired, after
+	// RebaseTTL is applied.
+	DropExpired bool
+	// RebaseTTL shifts the expiration time of loaded items by the time since
+	// the snapshot was created, so that they have the same remaining lifetime
+	// as when the snapshot was saved. It has no effect on legacy snapshots
+	// without a header, which don't record when they were created.
+	RebaseTTL bool
+}
+
+// MergeStrategy selects which item LoadWithOptions keeps when a loaded key
+// already exists in the cache.
+type MergeStrategy int
+
+const (
+	// KeepExisting keeps the existing item, which is what Load does.
+	KeepExisting MergeStrategy = iota
+	// Overwrite replaces the existing item with the loaded one.
+	Overwrite
+	// NewestExpiration keeps the item that expires last. An item that never
+	// expires wins over one that does; on a tie the existing item is kept.
+	NewestExpiration
+)
+
+// merge returns the item to store under k, or false if the existing item is
+// kept as it is.
+func (opts *LoadOptions) merge(k string, existing, loaded Item) (Item, bool) {
+	if opts.Resolve != nil {
+		return opts.Resolve(k, existing, loaded), true
+	}
+	switch opts.Merge {
+	case Overwrite:
+		return loaded, true
+	case NewestExpiration:
+		return loaded, expiresAfter(loaded, existing)
+	}
+	return existing, false
+}
+
+// expiresAfter reports whether a expires later than b.
+func expiresAfter(a, b Item) bool {
+	if a.Expiration == 0 || b.Expiration == 0 {
+		return a.Expiration == 0 && b.Expiration != 0
+	}
+	return a.Expiration > b.Expiration
+}
+
+// snapshotWriter encodes a point-in-time view of the cache while other
+// goroutines keep modifying it. Save walks the items map in chunks, holding
+// the cache's lock only while it encodes each chunk, and marks the items it
+// has encoded with its generation. Items written after Save started, i.e.
+// with a version above startVersion, are left out. Before a writer modifies
+// or deletes an item that Save hasn't reached yet, it encodes the item's
+// current value, its pre-image, with preserve, so every item is encoded
+// exactly once, as it was when Save started.
+type snapshotWriter struct {
+	gen          uint64
+	startVersion uint64
+	frame        bytes.Buffer
+	enc          ItemEncoder
+	// out holds the encoded frames that haven't been written yet.
+	out   bytes.Buffer
+	count uint64
+	err   error
+}
+
+func newSnapshotWriter(gen, startVersion uint64, codec Codec) *snapshotWriter {
+	s := &snapshotWriter{gen: gen, startVersion: startVersion}
+	s.enc = codec.NewEncoder(&s.frame)
+	return s
+}
+
+// wants reports whether item belongs in the snapshot and hasn't been encoded.
+func (s *snapshotWriter) wants(item Item) bool {
+	return item.version <= s.startVersion && item.saved != s.gen && !item.tombstone()
+}
+
+// encode appends a frame for item to out. The caller must hold c.mu.
+func (s *snapshotWriter) encode(k string, item Item) {
+	if s.err != nil {
+		return
+	}
 	defer func() {
 		if x := recover(); x != nil {
-			err = fmt.Errorf("Error registering item types with Gob library")
+			s.err = fmt.Errorf("Error encoding item %s: %v", k, x)
 		}
 	}()
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	for _, v := range c.items {
-		gob.Register(v.Object)
+	s.frame.Reset()
+	item.saved = 0
+	if err := s.enc.Encode(k, item); err != nil {
+		s.err = err
+		return
 	}
-	err = enc.Encode(&c.items)
-	return
+	var n [binary.MaxVarintLen64]byte
+	s.out.Write(n[:binary.PutUvarint(n[:], uint64(s.frame.Len()))])
+	s.out.Write(s.frame.Bytes())
+	s.count++
 }
 
-// SaveFile Save the cache's items to the given filename, creating the file if it
-// doesn't exist, and overwriting it if it does.
-func (c *Cache) SaveFile(fname string) error {
-	fp, err := os.Create(fname)
-	if err != nil {
+// preserve encodes the item stored under k if a Save is in progress and
+// hasn't encoded it yet, before the item is modified or deleted. The caller
+// must hold c.mu.
+func (c *Cache) preserve(k string) {
+	s := c.snapshot
+	if s == nil {
+		return
+	}
+	item, found := c.items[k]
+	if !found || !s.wants(item) {
+		return
+	}
+	s.encode(k, item)
+	item.saved = s.gen
+	c.items[k] = item
+}
+
+// Save Write the cache's items (using Gob) to an io.Writer. The items are
+// preceded by a header with the format version, the current time and the
+// cache's default expiration, and followed by the number of items and a
+// checksum, so that Load can detect truncated or corrupt snapshots. Tombstones
+// left by GetOrLoad are not saved.
+//
+// The snapshot holds the items as they were when Save was called, but the
+// cache is only locked for short periods while Save runs, so other goroutines
+// can keep using it.
+func (c *Cache) Save(w io.Writer) error {
+	return c.SaveWith(w, GobCodec)
+}
+
+// SaveWith Write the cache's items to an io.Writer like Save, encoding them with
+// codec.
+func (c *Cache) SaveWith(w io.Writer, codec Codec) error {
+	return c.SaveWithOptions(w, SaveOptions{Codec: codec})
+}
+
+// SaveWithOptions Write the cache's items to an io.Writer like Save, encoding,
+// compressing and encrypting them as configured by opts.
+func (c *Cache) SaveWithOptions(w io.Writer, opts SaveOptions) error {
+	if opts.Codec == nil {
+		opts.Codec = GobCodec
+	}
+	var header bytes.Buffer
+	header.Write(snapshotMagic[:])
+	binary.Write(&header, binary.BigEndian, uint16(snapshotVersion))
+	binary.Write(&header, binary.BigEndian, time.Now().UnixNano())
+	binary.Write(&header, binary.BigEndian, int64(c.defaultExpiration))
+	if err := writeHeaderString(&header, opts.Codec.Name()); err != nil {
 		return err
 	}
-	defer fp.Close()
-	if err := c.Save(fp); err != nil {
+	var compression string
+	if opts.Compression != nil {
+		compression = opts.Compression.Name()
+	}
+	if err := writeHeaderString(&header, compression); err != nil {
 		return err
 	}
+
+	// body is where everything after the header goes, and closers must be
+	// closed, in order, to finish it. The header is buffered along with the
+	// body, so that nothing is written to w before the snapshot starts.
+	out := bufio.NewWriter(w)
+	body := io.Writer(out)
+	var closers []io.Closer
+	// Close whatever is left open if the snapshot fails, to release the
+	// compressor's resources.
+	defer func() {
+		for _, cl := range closers {
+			cl.Close()
+		}
+	}()
+	if opts.Key != nil {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		aead, err := newGCM(opts.Key, salt)
+		if err != nil {
+			return err
+		}
+		header.WriteByte(flagEncrypted)
+		if err := writeHeaderString(&header, opts.KeyID); err != nil {
+			return err
+		}
+		header.Write(salt)
+		ew := newEncryptWriter(body, aead, bytes.Clone(header.Bytes()))
+		body = ew
+		closers = append(closers, ew)
+	} else {
+		header.WriteByte(0)
+	}
+	if opts.Compression != nil {
+		cw, err := opts.Compression.NewWriter(body)
+		if err != nil {
+			return err
+		}
+		body = cw
+		closers = append([]io.Closer{cw}, closers...)
+	}
+	out.Write(header.Bytes())
+	crc := crc32.New(crc32c)
+	crc.Write(header.Bytes())
+	bw := bufio.NewWriter(io.MultiWriter(body, crc))
+	if err := c.encodeItems(bw, opts.Codec); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := binary.Write(body, binary.BigEndian, crc.Sum32()); err != nil {
+		return err
+	}
+	for len(closers) > 0 {
+		cl := closers[0]
+		closers = closers[1:]
+		if err := cl.Close(); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func writeHeaderString(header *bytes.Buffer, s string) error {
+	if len(s) > math.MaxUint8 {
+		return fmt.Errorf("Header field %q is too long", s)
+	}
+	header.WriteByte(byte(len(s)))
+	header.WriteString(s)
 	return nil
 }
 
+// encodeItems writes the frames, the empty frame and the item count of a
+// point-in-time snapshot to bw. See snapshotWriter.
+func (c *Cache) encodeItems(bw *bufio.Writer, codec Codec) error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	c.snapshotGen++
+	s := newSnapshotWriter(c.snapshotGen, c.version, codec)
+	c.snapshot = s
+	items := c.items
+	c.mu.Unlock()
+
+	// flush writes out the frames encoded so far. It is called with c.mu held
+	// and releases it while writing.
+	flush := func() error {
+		out := s.out
+		s.out = bytes.Buffer{}
+		err := s.err
+		c.mu.Unlock()
+		defer c.mu.Lock()
+		if err != nil {
+			return err
+		}
+		_, err = bw.Write(out.Bytes())
+		return err
+	}
+
+	c.mu.Lock()
+	n := 0
+	var err error
+	// items may be modified between chunks, which a range loop allows: items
+	// added since the previous chunk may or may not be visited, and those
+	// deleted won't be, having been preserved first.
+	for k := range items {
+		if n == saveChunkSize {
+			if err = flush(); err != nil {
+				break
+			}
+			n = 0
+		}
+		if item, found := items[k]; found && s.wants(item) {
+			s.encode(k, item)
+			item.saved = s.gen
+			items[k] = item
+			n++
+		}
+	}
+	c.snapshot = nil
+	if err == nil {
+		err = flush()
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	bw.WriteByte(0)
+	return binary.Write(bw, binary.BigEndian, s.count)
+}
+
+// SaveFile Save the cache's items to the given filename, creating the file if it
+// doesn't exist, and overwriting it if it does. The items are written to a
+// temporary file in the same directory that is renamed over fname once it is
+// complete, so a crash never leaves a truncated file behind.
+func (c *Cache) SaveFile(fname string) error {
+	return writeFileAtomic(fname, c.Save)
+}
+
+// SaveFileWithOptions Save the cache's items to the given filename like SaveFile,
+// encoding, compressing and encrypting them as configured by opts.
+func (c *Cache) SaveFileWithOptions(fname string, opts SaveOptions) error {
+	return writeFileAtomic(fname, func(w io.Writer) error {
+		return c.SaveWithOptions(w, opts)
+	})
+}
+
 // Load Add (Gob-serialized) cache items from an io.Reader, excluding any items with
-// keys that already exist (and haven't expired) in the current cache.
+// keys that already exist (and haven't expired) in the current cache. The
+// whole snapshot is validated before any item is added. Legacy snapshots
+// without a header are also accepted.
 func (c *Cache) Load(r io.Reader) error {
-	dec := gob.NewDecoder(r)
-	items := map[string]Item{}
-	if err := dec.Decode(&items); err != nil {
+	return c.LoadWith(r, GobCodec)
+}
+
+// LoadWith Add cache items from an io.Reader like Load, decoding them with codec.
+// Returns an error if the snapshot was saved with another codec. Legacy
+// snapshots and those saved before codecs were introduced can only be loaded
+// with GobCodec.
+func (c *Cache) LoadWith(r io.Reader, codec Codec) error {
+	return c.LoadWithOptions(r, LoadOptions{Codec: codec})
+}
+
+// LoadWithOptions Add cache items from an io.Reader like Load, decrypting,
+// decompressing and decoding them, merging them with the existing items and
+// adjusting their expiration as configured by opts. Returns an error wrapping
+// ErrWrongKey if the snapshot is encrypted and there is no key for its key ID,
+// or the key is wrong.
+func (c *Cache) LoadWithOptions(r io.Reader, opts LoadOptions) error {
+	if opts.Codec == nil {
+		opts.Codec = GobCodec
+	}
+	info, items, err := decodeSnapshot(r, opts)
+	if err != nil {
 		return err
 	}
+	c.loadItems(info, items, opts)
+	return nil
+}
+
+// loadItems adds the items decoded from a snapshot as configured by opts.
+func (c *Cache) loadItems(info SnapshotInfo, items map[string]Item, opts LoadOptions) {
+	var shift int64
+	if opts.RebaseTTL && !info.Created.IsZero() {
+		shift = int64(time.Since(info.Created))
+	}
+	now := time.Now().UnixNano()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	for k, v := range items {
-		if ov, found := c.items[k]; !found || ov.Expired() {
-			c.items[k] = v
+		if v.Expiration > 0 {
+			v.Expiration += shift
+			if opts.DropExpired && v.Expiration <= now {
+				continue
+			}
+		}
+		if existing, found := c.lookup(k); found {
+			var ok bool
+			if v, ok = opts.merge(k, existing, v); !ok {
+				continue
+			}
 		}
+		c.write(k, v)
 	}
-	return nil
 }
 
 // LoadFile Load and add cache items from the given filename, excluding any items with
@@ -66,3 +480,325 @@ func (c *Cache) LoadFile(fname string) error {
 	defer fp.Close()
 	return c.Load(fp)
 }
+
+// LoadFileWithOptions Load and add cache items from the given filename like
+// LoadFile, decrypting, decompressing and decoding them as configured by opts.
+func (c *Cache) LoadFileWithOptions(fname string, opts LoadOptions) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return c.LoadWithOptions(fp, opts)
+}
+
+// ReadSnapshotInfo reads the metadata of a snapshot written by Save. The item
+// count is stored after the items, so the whole snapshot is read and validated, unless it is encrypted or compressed
+// with a compression that isn't built in, in which case Count is -1.
+func ReadSnapshotInfo(r io.Reader) (SnapshotInfo, error) {
+	br := bufio.NewReader(r)
+	if !hasSnapshotMagic(br) {
+		return SnapshotInfo{Codec: GobCodec.Name()}, nil
+	}
+	cr := &crcReader{r: br, crc: crc32.New(crc32c)}
+	info, h, err := readSnapshotHeader(cr)
+	if err != nil {
+		return info, err
+	}
+	if info.Encrypted || (info.Compression != "" && findCompression(info.Compression, nil) == nil) {
+		info.Count = -1
+		return info, nil
+	}
+	finish, err := openBody(cr, info, h, LoadOptions{})
+	if err != nil {
+		return info, err
+	}
+	err = decodeFrames(cr, &info, nil, nil)
+	if ferr := finish(); err == nil {
+		err = ferr
+	}
+	return info, err
+}
+
+// decodeSnapshot reads and validates a snapshot whose items were encoded with
+// opts.Codec.
+func decodeSnapshot(r io.Reader, opts LoadOptions) (SnapshotInfo, map[string]Item, error) {
+	codec := opts.Codec
+	items := map[string]Item{}
+	br := bufio.NewReader(r)
+	if isShardedSnapshot(br) {
+		return SnapshotInfo{}, nil, fmt.Errorf("%w: snapshot of a sharded cache", ErrInvalidSnapshot)
+	}
+	if !hasSnapshotMagic(br) {
+		if codec.Name() != GobCodec.Name() {
+			return SnapshotInfo{}, nil, wrongCodec(GobCodec.Name(), codec)
+		}
+		if err := gob.NewDecoder(br).Decode(&items); err != nil {
+			return SnapshotInfo{}, nil, err
+		}
+		return SnapshotInfo{Count: len(items), Codec: GobCodec.Name()}, items, nil
+	}
+
+	cr := &crcReader{r: br, crc: crc32.New(crc32c)}
+	info, h, err := readSnapshotHeader(cr)
+	if err != nil {
+		return info, nil, err
+	}
+	if info.Codec != codec.Name() {
+		return info, nil, wrongCodec(info.Codec, codec)
+	}
+	finish, err := openBody(cr, info, h, opts)
+	if err != nil {
+		return info, nil, err
+	}
+	err = decodeFrames(cr, &info, codec, func(k string, v Item) { items[k] = v })
+	if ferr := finish(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return info, nil, err
+	}
+	return info, items, nil
+}
+
+// openBody makes cr read the data following the header of a snapshot through the decryption and decompression it needs. The returned
+// function must be called once the frames were decoded. It reads the rest of
+// the body, so that the end of the compressed and encrypted data is
+// validated too, and closes the decompressor.
+func openBody(cr *crcReader, info SnapshotInfo, h snapshotHeader, opts LoadOptions) (func() error, error) {
+	body := io.Reader(cr.r)
+	var drain []io.Reader
+	var closer io.Closer
+	if info.Encrypted {
+		key, ok := opts.Keys[info.KeyID]
+		if !ok {
+			return nil, fmt.Errorf("%w: no key with ID %q", ErrWrongKey, info.KeyID)
+		}
+		aead, err := newGCM(key, h.salt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWrongKey, err)
+		}
+		body = newDecryptReader(body, aead, h.raw)
+		drain = append(drain, body)
+	}
+	if info.Compression != "" {
+		comp := findCompression(info.Compression, opts.Compressions)
+		if comp == nil {
+			return nil, fmt.Errorf("Snapshot was compressed with %s, which is not in LoadOptions.Compressions", info.Compression)
+		}
+		zr, err := comp.NewReader(body)
+		if err != nil {
+			return nil, bodyError(err, "compressed data truncated")
+		}
+		body = zr
+		drain = append([]io.Reader{zr}, drain...)
+		closer = zr
+	}
+	cr.r = bufio.NewReader(body)
+	drain = append([]io.Reader{cr.r}, drain...)
+	return func() error {
+		if closer != nil {
+			defer closer.Close()
+		}
+		for _, r := range drain {
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return bodyError(err, "compressed data truncated")
+			}
+		}
+		return nil
+	}, nil
+}
+
+func findCompression(name string, extra []Compression) Compression {
+	for _, comp := range append([]Compression{Gzip, Flate}, extra...) {
+		if comp.Name() == name {
+			return comp
+		}
+	}
+	return nil
+}
+
+// bodyError returns an error for err, returned while reading the data
+// following the header. Errors from the decryption are returned as they are.
+func bodyError(err error, truncated string) error {
+	switch {
+	case errors.Is(err, ErrWrongKey), errors.Is(err, ErrInvalidSnapshot):
+		return err
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: %s", ErrInvalidSnapshot, truncated)
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+}
+
+func wrongCodec(name string, codec Codec) error {
+	return fmt.Errorf("Snapshot was saved with the %s codec, not %s", name, codec.Name())
+}
+
+func hasSnapshotMagic(br *bufio.Reader) bool {
+	magic, _ := br.Peek(len(snapshotMagic))
+	return bytes.Equal(magic, snapshotMagic[:])
+}
+
+// crcReader computes the checksum of the bytes read through it.
+// If raw is set, the bytes are also recorded in it.
+type crcReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	raw *bytes.Buffer
+}
+
+func (cr *crcReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.crc.Write(p[:n])
+	if cr.raw != nil {
+		cr.raw.Write(p[:n])
+	}
+	return n, err
+}
+
+func (cr *crcReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{b})
+		if cr.raw != nil {
+			cr.raw.WriteByte(b)
+		}
+	}
+	return b, err
+}
+
+// checkSum reads the checksum at the end of a snapshot and compares it with
+// the checksum of everything read before it.
+func (cr *crcReader) checkSum() error {
+	want := cr.crc.Sum32()
+	var sum uint32
+	if err := binary.Read(cr.r, binary.BigEndian, &sum); err != nil {
+		return bodyError(err, "checksum missing")
+	}
+	if sum != want {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+	return nil
+}
+
+// snapshotHeader holds the parts of a snapshot header needed to read the rest
+// of the snapshot, but not exposed in SnapshotInfo.
+type snapshotHeader struct {
+	// salt is the salt of encrypted snapshots.
+	salt []byte
+	// raw is the header as it was read, including the magic bytes.
+	raw []byte
+}
+
+// readSnapshotHeader reads the magic bytes and header.
+func readSnapshotHeader(cr *crcReader) (SnapshotInfo, snapshotHeader, error) {
+	var h snapshotHeader
+	var version uint16
+	var created, de int64
+	cr.raw = &bytes.Buffer{}
+	defer func() { cr.raw = nil }()
+	if _, err := io.CopyN(io.Discard, cr, int64(len(snapshotMagic))); err != nil {
+		return SnapshotInfo{}, h, err
+	}
+	if err := binary.Read(cr, binary.BigEndian, &version); err != nil {
+		return SnapshotInfo{}, h, errHeaderTruncated
+	}
+	if version != snapshotVersion {
+		return SnapshotInfo{}, h, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, version)
+	}
+	for _, f := range []any{&created, &de} {
+		if err := binary.Read(cr, binary.BigEndian, f); err != nil {
+			return SnapshotInfo{}, h, errHeaderTruncated
+		}
+	}
+	info := SnapshotInfo{
+		Version:           int(version),
+		Created:           time.Unix(0, created),
+		DefaultExpiration: time.Duration(de),
+	}
+	var err error
+	if info.Codec, err = readHeaderString(cr); err != nil {
+		return info, h, err
+	}
+	if info.Compression, err = readHeaderString(cr); err != nil {
+		return info, h, err
+	}
+	flags, err := cr.ReadByte()
+	if err != nil {
+		return info, h, errHeaderTruncated
+	}
+	if flags&^flagEncrypted != 0 {
+		return info, h, fmt.Errorf("%w: unsupported flags %#x", ErrInvalidSnapshot, flags)
+	}
+	if flags&flagEncrypted != 0 {
+		info.Encrypted = true
+		if info.KeyID, err = readHeaderString(cr); err != nil {
+			return info, h, err
+		}
+		if h.salt, err = readBytes(cr, saltSize); err != nil {
+			return info, h, errHeaderTruncated
+		}
+	}
+	h.raw = cr.raw.Bytes()
+	return info, h, nil
+}
+
+var errHeaderTruncated = fmt.Errorf("%w: header truncated", ErrInvalidSnapshot)
+
+func readHeaderString(cr *crcReader) (string, error) {
+	n, err := cr.ReadByte()
+	if err != nil {
+		return "", errHeaderTruncated
+	}
+	b, err := readBytes(cr, uint64(n))
+	if err != nil {
+		return "", errHeaderTruncated
+	}
+	return string(b), nil
+}
+
+// decodeFrames decodes the frames, count and checksum of a snapshot with codec, calling f for every item, and sets info.Count. Since
+// the checksum comes last, f may be called for items of a snapshot that turns
+// out to be invalid. If codec is nil, the frames are only counted.
+func decodeFrames(cr *crcReader, info *SnapshotInfo, codec Codec, f func(string, Item)) error {
+	var stream bytes.Buffer
+	var dec ItemDecoder
+	if codec != nil {
+		dec = codec.NewDecoder(&stream)
+	}
+	n := 0
+	for {
+		length, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return bodyError(err, fmt.Sprintf("truncated after %d items", n))
+		}
+		if length == 0 {
+			break
+		}
+		if _, err := io.CopyN(&stream, cr, int64(length)); err != nil {
+			return bodyError(err, fmt.Sprintf("truncated after %d items", n))
+		}
+		if dec == nil {
+			stream.Reset()
+		} else {
+			k, item, err := dec.Decode()
+			if err != nil {
+				return fmt.Errorf("%w: item %d: %v", ErrInvalidSnapshot, n, err)
+			}
+			f(k, item)
+		}
+		n++
+	}
+	var count uint64
+	if err := binary.Read(cr, binary.BigEndian, &count); err != nil {
+		return bodyError(err, "item count missing")
+	}
+	if err := cr.checkSum(); err != nil {
+		return err
+	}
+	if count != uint64(n) {
+		return fmt.Errorf("%w: %d items, footer says %d", ErrInvalidSnapshot, n, count)
+	}
+	info.Count = n
+	return nil
+}
@@ -2,9 +2,13 @@ package cache
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
+	"fmt"
+	"hash/crc32"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -21,9 +25,7 @@ func TestCache_Save(t *testing.T) {
 		assert.NoError(t, err)
 
 		// Decode the saved data to verify
-		dec := gob.NewDecoder(&buf)
-		items := map[string]Item{}
-		err = dec.Decode(&items)
+		_, items, err := decodeSnapshot(&buf, LoadOptions{Codec: GobCodec})
 
 		assert.NoError(t, err)
 		assert.Equal(t, 2, len(items))
@@ -32,6 +34,119 @@ func TestCache_Save(t *testing.T) {
 	})
 }
 
+func TestCache_Save_Format(t *testing.T) {
+	save := func(t *testing.T) []byte {
+		c := New(time.Minute, 0)
+		c.Set("key1", "value1", NoExpiration)
+		c.Set("key2", "value2", NoExpiration)
+		var buf bytes.Buffer
+		assert.NoError(t, c.Save(&buf))
+		return buf.Bytes()
+	}
+
+	t.Run("Write a header with metadata", func(t *testing.T) {
+		before := time.Now()
+		info, err := ReadSnapshotInfo(bytes.NewReader(save(t)))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, info.Version)
+		assert.Equal(t, "gob", info.Codec)
+		assert.Equal(t, time.Minute, info.DefaultExpiration)
+		assert.Equal(t, 2, info.Count)
+		assert.WithinDuration(t, before, info.Created, time.Second)
+	})
+
+	t.Run("Reject truncated snapshots", func(t *testing.T) {
+		data := save(t)
+		for _, n := range []int{10, len(data) / 2, len(data) - 2} {
+			c := New(DefaultExpiration, 0)
+			err := c.Load(bytes.NewReader(data[:n]))
+			assert.ErrorIs(t, err, ErrInvalidSnapshot)
+			assert.Zero(t, c.ItemCount())
+		}
+	})
+
+	t.Run("Reject corrupt snapshots", func(t *testing.T) {
+		data := save(t)
+		data[len(data)-10] ^= 0xff
+		err := New(DefaultExpiration, 0).Load(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrInvalidSnapshot)
+		assert.ErrorContains(t, err, "checksum mismatch")
+	})
+
+	t.Run("Reject unsupported versions", func(t *testing.T) {
+		data := save(t)
+		data[len(snapshotMagic)+1] = 9
+		err := New(DefaultExpiration, 0).Load(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrInvalidSnapshot)
+		assert.ErrorContains(t, err, "unsupported version 9")
+	})
+}
+
+// hookWriter calls hook before the first write that reaches it.
+type hookWriter struct {
+	bytes.Buffer
+	hook func()
+}
+
+func (w *hookWriter) Write(p []byte) (int, error) {
+	if w.hook != nil {
+		w.hook()
+		w.hook = nil
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestCache_Save_Consistency(t *testing.T) {
+	t.Run("Save the items as they were when Save was called", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		want := map[string]any{}
+		for i := 0; i < 5*saveChunkSize; i++ {
+			k := fmt.Sprintf("key%d", i)
+			c.Set(k, i, NoExpiration)
+			want[k] = i
+		}
+		_, _ = c.HSet("hash", "field", "old")
+		want["hash"] = map[string]string{"field": "old"}
+
+		w := &hookWriter{hook: func() {
+			for i := 0; i < 5*saveChunkSize; i += 2 {
+				c.Set(fmt.Sprintf("key%d", i), -1, NoExpiration)
+			}
+			for i := 1; i < 5*saveChunkSize; i += 4 {
+				c.Delete(fmt.Sprintf("key%d", i))
+			}
+			c.Set("new", "value", NoExpiration)
+			_, _ = c.HSet("hash", "field", "new")
+		}}
+		assert.NoError(t, c.Save(w))
+		assert.Nil(t, w.hook)
+
+		_, items, err := decodeSnapshot(&w.Buffer, LoadOptions{Codec: GobCodec})
+		assert.NoError(t, err)
+		assert.Equal(t, want, itemObjects(items))
+		val, _ := c.Get("key0")
+		assert.Equal(t, -1, val)
+	})
+
+	t.Run("Writers are not blocked for the whole save", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		for i := 0; i < 5*saveChunkSize; i++ {
+			c.Set(fmt.Sprintf("key%d", i), i, NoExpiration)
+		}
+
+		written := make(chan struct{})
+		w := &hookWriter{hook: func() {
+			go func() {
+				c.Set("key0", -1, NoExpiration)
+				close(written)
+			}()
+			<-written
+		}}
+		assert.NoError(t, c.Save(w))
+	})
+}
+
 func TestCache_SaveFile(t *testing.T) {
 	t.Run("Save cache items to file", func(t *testing.T) {
 		c := New(DefaultExpiration, 0)
@@ -49,9 +164,7 @@ func TestCache_SaveFile(t *testing.T) {
 		assert.NoError(t, err)
 		defer file.Close()
 
-		dec := gob.NewDecoder(file)
-		items := map[string]Item{}
-		err = dec.Decode(&items)
+		_, items, err := decodeSnapshot(file, LoadOptions{Codec: GobCodec})
 
 		assert.NoError(t, err)
 		assert.Equal(t, 2, len(items))
@@ -88,6 +201,102 @@ func TestCache_Load(t *testing.T) {
 	})
 }
 
+func TestCache_LoadWithOptions(t *testing.T) {
+	// snapshot returns a snapshot of items saved age ago.
+	snapshot := func(t *testing.T, age time.Duration, items map[string]Item) []byte {
+		c := NewFrom(DefaultExpiration, 0, items)
+		var buf bytes.Buffer
+		assert.NoError(t, c.Save(&buf))
+		data := buf.Bytes()
+		created := time.Now().Add(-age).UnixNano()
+		binary.BigEndian.PutUint64(data[len(snapshotMagic)+2:], uint64(created))
+		binary.BigEndian.PutUint32(data[len(data)-4:], crc32.Checksum(data[:len(data)-4], crc32c))
+		return data
+	}
+	in := func(d time.Duration) int64 {
+		return time.Now().Add(d).UnixNano()
+	}
+
+	t.Run("Merge with existing items", func(t *testing.T) {
+		data := snapshot(t, 0, map[string]Item{
+			"a": {Object: "loaded", Expiration: in(time.Hour)},
+			"b": {Object: "loaded", Expiration: in(time.Minute)},
+			"c": {Object: "loaded"},
+			"d": {Object: "loaded"},
+		})
+		existing := func() *Cache {
+			c := New(DefaultExpiration, 0)
+			c.Set("a", "existing", time.Minute)
+			c.Set("b", "existing", time.Hour)
+			c.Set("c", "existing", time.Hour)
+			return c
+		}
+
+		tests := []struct {
+			name string
+			opts LoadOptions
+			want map[string]any
+		}{
+			{"Keep existing", LoadOptions{}, map[string]any{"a": "existing", "b": "existing", "c": "existing", "d": "loaded"}},
+			{"Overwrite", LoadOptions{Merge: Overwrite}, map[string]any{"a": "loaded", "b": "loaded", "c": "loaded", "d": "loaded"}},
+			{"Newest expiration", LoadOptions{Merge: NewestExpiration}, map[string]any{"a": "loaded", "b": "existing", "c": "loaded", "d": "loaded"}},
+			{"Resolve", LoadOptions{Merge: Overwrite, Resolve: func(k string, existing, loaded Item) Item {
+				existing.Object = existing.Object.(string) + "+" + loaded.Object.(string)
+				return existing
+			}}, map[string]any{"a": "existing+loaded", "b": "existing+loaded", "c": "existing+loaded", "d": "loaded"}},
+		}
+		for _, tt := range tests {
+			c := existing()
+			assert.NoError(t, c.LoadWithOptions(bytes.NewReader(data), tt.opts), tt.name)
+			assert.Equal(t, tt.want, itemObjects(c.Items()), tt.name)
+		}
+	})
+
+	t.Run("Keep the version of kept items", func(t *testing.T) {
+		data := snapshot(t, 0, map[string]Item{"a": {Object: "loaded"}})
+		c := New(DefaultExpiration, 0)
+		c.Set("a", "existing", NoExpiration)
+		_, version, _ := c.GetWithVersion("a")
+		assert.NoError(t, c.LoadWithOptions(bytes.NewReader(data), LoadOptions{Merge: NewestExpiration}))
+		_, after, _ := c.GetWithVersion("a")
+		assert.Equal(t, version, after)
+	})
+
+	t.Run("Drop expired items", func(t *testing.T) {
+		data := snapshot(t, 0, map[string]Item{
+			"expired": {Object: 1, Expiration: in(-time.Second)},
+			"live":    {Object: 2, Expiration: in(time.Hour)},
+		})
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.LoadWithOptions(bytes.NewReader(data), LoadOptions{}))
+		assert.Len(t, c.items, 2)
+
+		c = New(DefaultExpiration, 0)
+		assert.NoError(t, c.LoadWithOptions(bytes.NewReader(data), LoadOptions{DropExpired: true}))
+		assert.Equal(t, map[string]any{"live": 2}, itemObjects(c.Items()))
+		assert.Len(t, c.items, 1)
+	})
+
+	t.Run("Rebase expirations by the time spent on disk", func(t *testing.T) {
+		// Saved an hour ago with 10 minutes left, and with 2 hours left.
+		data := snapshot(t, time.Hour, map[string]Item{
+			"short":   {Object: 1, Expiration: in(-50 * time.Minute)},
+			"long":    {Object: 2, Expiration: in(time.Hour)},
+			"forever": {Object: 3},
+		})
+		c := New(DefaultExpiration, 0)
+		assert.NoError(t, c.LoadWithOptions(bytes.NewReader(data), LoadOptions{RebaseTTL: true, DropExpired: true}))
+		assert.Len(t, c.items, 3)
+		assert.InDelta(t, in(10*time.Minute), c.items["short"].Expiration, float64(time.Second))
+		assert.InDelta(t, in(2*time.Hour), c.items["long"].Expiration, float64(time.Second))
+		assert.Zero(t, c.items["forever"].Expiration)
+
+		c = New(DefaultExpiration, 0)
+		assert.NoError(t, c.LoadWithOptions(bytes.NewReader(data), LoadOptions{DropExpired: true}))
+		assert.Len(t, c.items, 2)
+	})
+}
+
 func TestCache_LoadFile(t *testing.T) {
 	t.Run("Load cache items from file", func(t *testing.T) {
 		c := New(DefaultExpiration, 0)
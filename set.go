@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+)
+
+// StringSet is the value stored by the set commands, e.g. SAdd.
+type StringSet map[string]struct{}
+
+// GobEncode encodes the set as its sorted members, since Gob can't encode
+// empty structs.
+func (s StringSet) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(s.members())
+	return buf.Bytes(), err
+}
+
+// GobDecode decodes a set encoded by GobEncode.
+func (s *StringSet) GobDecode(b []byte) error {
+	var members []string
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&members); err != nil {
+		return err
+	}
+	*s = make(StringSet, len(members))
+	for _, m := range members {
+		(*s)[m] = struct{}{}
+	}
+	return nil
+}
+
+func (s StringSet) members() []string {
+	members := make([]string, 0, len(s))
+	for m := range s {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// SAdd adds members to the set stored under k, creating the set if the key
+// doesn't exist. Returns the number of members that were not already in the
+// set.
+func (c *Cache) SAdd(k string, members ...string) (int, error) {
+	var n int
+	err := updateCollection(c, k, func(s StringSet) StringSet {
+		if s == nil {
+			s = make(StringSet, len(members))
+		}
+		for _, m := range members {
+			if _, found := s[m]; !found {
+				s[m] = struct{}{}
+				n++
+			}
+		}
+		return s
+	})
+	return n, err
+}
+
+// SRem removes members from the set stored under k. Returns the number of
+// members that were in the set. The key is deleted when its last member is
+// removed.
+func (c *Cache) SRem(k string, members ...string) (int, error) {
+	var n int
+	err := updateCollection(c, k, func(s StringSet) StringSet {
+		for _, m := range members {
+			if _, found := s[m]; found {
+				delete(s, m)
+				n++
+			}
+		}
+		return s
+	})
+	return n, err
+}
+
+// SIsMember reports whether member is in the set stored under k.
+func (c *Cache) SIsMember(k string, member string) (bool, error) {
+	var found bool
+	err := readCollection(c, k, func(s StringSet) {
+		_, found = s[member]
+	})
+	return found, err
+}
+
+// SMembers returns the members of the set stored under k, sorted.
+func (c *Cache) SMembers(k string) ([]string, error) {
+	var members []string
+	err := readCollection(c, k, func(s StringSet) {
+		members = s.members()
+	})
+	return members, err
+}
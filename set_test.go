@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_SAdd(t *testing.T) {
+	t.Run("Add new and existing members", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		n, err := c.SAdd("set", "a", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		n, err = c.SAdd("set", "b", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		members, _ := c.SMembers("set")
+		assert.Equal(t, []string{"a", "b", "c"}, members)
+	})
+
+	t.Run("Add to a key holding another kind of value", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.RPush("list", "a")
+		_, err := c.SAdd("list", "a")
+		assert.ErrorIs(t, err, ErrWrongType)
+	})
+}
+
+func TestCache_SRem(t *testing.T) {
+	t.Run("Remove members and delete the empty set", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.SAdd("set", "a", "b")
+
+		n, err := c.SRem("set", "a", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		_, _ = c.SRem("set", "b")
+		_, found := c.Get("set")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_SIsMember(t *testing.T) {
+	t.Run("Check membership", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.SAdd("set", "a")
+
+		found, err := c.SIsMember("set", "a")
+		assert.NoError(t, err)
+		assert.True(t, found)
+
+		found, _ = c.SIsMember("set", "b")
+		assert.False(t, found)
+
+		found, _ = c.SIsMember("missing", "a")
+		assert.False(t, found)
+	})
+}
+
+func TestStringSet_Gob(t *testing.T) {
+	t.Run("Save and load a set", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		_, _ = c.SAdd("set", "a", "b")
+
+		var buf bytes.Buffer
+		assert.NoError(t, c.Save(&buf))
+
+		c2 := New(DefaultExpiration, 0)
+		assert.NoError(t, c2.Load(&buf))
+
+		members, err := c2.SMembers("set")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, members)
+	})
+}
@@ -1,9 +1,16 @@
 package cache
 
-import "time"
+import (
+	"sort"
+	"time"
+)
+
+func (sc *shardedCache) shardIndex(k string) uint32 {
+	return djb33(sc.seed, k) % sc.m
+}
 
 func (sc *shardedCache) bucket(k string) *Cache {
-	return sc.cs[djb33(sc.seed, k)%sc.m]
+	return sc.cs[sc.shardIndex(k)]
 }
 
 func (sc *shardedCache) Set(k string, x any, d time.Duration) {
@@ -22,6 +29,26 @@ func (sc *shardedCache) Get(k string) (any, bool) {
 	return sc.bucket(k).Get(k)
 }
 
+func (sc *shardedCache) GetWithVersion(k string) (any, uint64, bool) {
+	return sc.bucket(k).GetWithVersion(k)
+}
+
+func (sc *shardedCache) SetIfVersion(k string, x any, d time.Duration, version uint64) error {
+	return sc.bucket(k).SetIfVersion(k, x, d, version)
+}
+
+func (sc *shardedCache) GetAndDelete(k string) (any, bool) {
+	return sc.bucket(k).GetAndDelete(k)
+}
+
+func (sc *shardedCache) GetAndSet(k string, x any, d time.Duration) (any, bool) {
+	return sc.bucket(k).GetAndSet(k, x, d)
+}
+
+func (sc *shardedCache) GetEx(k string, d time.Duration) (any, bool) {
+	return sc.bucket(k).GetEx(k, d)
+}
+
 func (sc *shardedCache) Increment(k string, n int64) error {
 	return sc.bucket(k).Increment(k, n)
 }
@@ -30,10 +57,34 @@ func (sc *shardedCache) IncrementFloat(k string, n float64) error {
 	return sc.bucket(k).IncrementFloat(k, n)
 }
 
+func (sc *shardedCache) IncrementOrInitInt64(k string, n, initial int64, d time.Duration) (int64, error) {
+	return sc.bucket(k).IncrementOrInitInt64(k, n, initial, d)
+}
+
+func (sc *shardedCache) IncrementOrInitUint64(k string, n, initial uint64, d time.Duration) (uint64, error) {
+	return sc.bucket(k).IncrementOrInitUint64(k, n, initial, d)
+}
+
+func (sc *shardedCache) IncrementOrInitFloat64(k string, n, initial float64, d time.Duration) (float64, error) {
+	return sc.bucket(k).IncrementOrInitFloat64(k, n, initial, d)
+}
+
 func (sc *shardedCache) Decrement(k string, n int64) error {
 	return sc.bucket(k).Decrement(k, n)
 }
 
+func (sc *shardedCache) Update(k string, f func(old any, found bool) (any, time.Duration, bool)) {
+	sc.bucket(k).Update(k, f)
+}
+
+func (sc *shardedCache) CompareAndSwap(k string, old, new any) bool {
+	return sc.bucket(k).CompareAndSwap(k, old, new)
+}
+
+func (sc *shardedCache) CompareAndDelete(k string, old any) bool {
+	return sc.bucket(k).CompareAndDelete(k, old)
+}
+
 func (sc *shardedCache) Delete(k string) {
 	sc.bucket(k).Delete(k)
 }
@@ -52,8 +103,114 @@ func (sc *shardedCache) Items() []map[string]Item {
 	return res
 }
 
+func (sc *shardedCache) SetOverflowPolicy(p OverflowPolicy) {
+	for _, v := range sc.cs {
+		v.SetOverflowPolicy(p)
+	}
+}
+
 func (sc *shardedCache) Flush() {
 	for _, v := range sc.cs {
 		v.Flush()
 	}
 }
+
+// groupKeys splits keys by the shard they belong to, so that each shard lock is
+// taken once per batch operation.
+func (sc *shardedCache) groupKeys(keys []string) map[*Cache][]string {
+	groups := make(map[*Cache][]string)
+	for _, k := range keys {
+		b := sc.bucket(k)
+		groups[b] = append(groups[b], k)
+	}
+	return groups
+}
+
+func (sc *shardedCache) GetMany(keys []string) map[string]any {
+	m := make(map[string]any, len(keys))
+	for b, ks := range sc.groupKeys(keys) {
+		for k, x := range b.GetMany(ks) {
+			m[k] = x
+		}
+	}
+	return m
+}
+
+func (sc *shardedCache) SetMany(items map[string]any, d time.Duration) {
+	groups := make(map[*Cache]map[string]any)
+	for k, x := range items {
+		b := sc.bucket(k)
+		if groups[b] == nil {
+			groups[b] = make(map[string]any)
+		}
+		groups[b][k] = x
+	}
+	for b, m := range groups {
+		b.SetMany(m, d)
+	}
+}
+
+func (sc *shardedCache) DeleteMany(keys []string) {
+	for b, ks := range sc.groupKeys(keys) {
+		b.DeleteMany(ks)
+	}
+}
+
+func (sc *shardedCache) Watch(keys ...string) *WatchSet {
+	w := &WatchSet{versions: make(map[string]uint64, len(keys))}
+	for _, k := range keys {
+		c := sc.bucket(k)
+		c.mu.RLock()
+		w.versions[k] = c.versionOf(k)
+		c.mu.RUnlock()
+	}
+	return w
+}
+
+// Txn runs fn atomically across shards. Only the given keys and the watched
+// keys may be accessed by fn; using any other key makes Txn fail with
+// ErrUndeclaredKey. The shards owning those keys are locked in ascending shard
+// order, so concurrent transactions cannot deadlock.
+func (sc *shardedCache) Txn(keys []string, fn func(tx *Tx) error, watches ...*WatchSet) error {
+	shards := make(map[string]*Cache)
+	locked := make(map[uint32]*Cache)
+	declare := func(k string) {
+		i := sc.shardIndex(k)
+		shards[k] = sc.cs[i]
+		locked[i] = sc.cs[i]
+	}
+	for _, k := range keys {
+		declare(k)
+	}
+	for _, w := range watches {
+		for k := range w.versions {
+			declare(k)
+		}
+	}
+	order := make([]uint32, 0, len(locked))
+	for i := range locked {
+		order = append(order, i)
+	}
+	sort.Slice(order, func(a, b int) bool { return order[a] < order[b] })
+
+	tx := &Tx{
+		bucket: func(k string) *Cache { return shards[k] },
+		writes: make(map[string]txWrite),
+	}
+	for _, i := range order {
+		locked[i].mu.Lock()
+	}
+	evictedItems, err := func() ([]evictedItem, error) {
+		defer func() {
+			for j := len(order) - 1; j >= 0; j-- {
+				locked[order[j]].mu.Unlock()
+			}
+		}()
+		return tx.run(fn, watches)
+	}()
+	if err != nil {
+		return err
+	}
+	notifyEvicted(evictedItems)
+	return nil
+}
@@ -1,6 +1,9 @@
 package cache
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 // ShardedCache interface
 type ShardedCache interface {
@@ -8,13 +11,38 @@ type ShardedCache interface {
 	Add(k string, x any, d time.Duration) error
 	Replace(k string, x any, d time.Duration) error
 	Get(k string) (any, bool)
+	GetWithVersion(k string) (any, uint64, bool)
+	SetIfVersion(k string, x any, d time.Duration, version uint64) error
+	GetAndDelete(k string) (any, bool)
+	GetAndSet(k string, x any, d time.Duration) (any, bool)
+	GetEx(k string, d time.Duration) (any, bool)
 	Increment(k string, n int64) error
 	IncrementFloat(k string, n float64) error
+	IncrementOrInitInt64(k string, n, initial int64, d time.Duration) (int64, error)
+	IncrementOrInitUint64(k string, n, initial uint64, d time.Duration) (uint64, error)
+	IncrementOrInitFloat64(k string, n, initial float64, d time.Duration) (float64, error)
 	Decrement(k string, n int64) error
+	SetOverflowPolicy(p OverflowPolicy)
+	Update(k string, f func(old any, found bool) (any, time.Duration, bool))
+	CompareAndSwap(k string, old, new any) bool
+	CompareAndDelete(k string, old any) bool
 	Delete(k string)
+	GetMany(keys []string) map[string]any
+	SetMany(items map[string]any, d time.Duration)
+	DeleteMany(keys []string)
+	Watch(keys ...string) *WatchSet
+	Txn(keys []string, fn func(tx *Tx) error, watches ...*WatchSet) error
 	DeleteExpired()
 	Items() []map[string]Item
 	Flush()
+	Save(w io.Writer) error
+	SaveWithOptions(w io.Writer, opts SaveOptions) error
+	SaveFile(fname string) error
+	SaveFileWithOptions(fname string, opts SaveOptions) error
+	Load(r io.Reader) error
+	LoadWithOptions(r io.Reader, opts LoadOptions) error
+	LoadFile(fname string) error
+	LoadFileWithOptions(fname string, opts LoadOptions) error
 }
 
 type shardedCache struct {
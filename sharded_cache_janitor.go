@@ -2,12 +2,14 @@ package cache
 
 import (
 	"runtime"
+	"sync"
 	"time"
 )
 
 type shardedJanitor struct {
 	Interval time.Duration
 	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 func (j *shardedJanitor) Run(sc *shardedCache) {
@@ -23,9 +25,10 @@ func (j *shardedJanitor) Run(sc *shardedCache) {
 	}
 }
 
-// Stop sends a signal to stop the janitor's Run loop and waits for it to finish
+// Stop sends a signal to stop the janitor's Run loop. It may be called more
+// than once, e.g. by both finalizers of an unexportedShardedCache.
 func (j *shardedJanitor) Stop() {
-	close(j.stop)
+	j.stopOnce.Do(func() { close(j.stop) })
 }
 
 func stopShardedJanitor(sc *unexportedShardedCache) {
@@ -175,3 +175,205 @@ func TestShardedCache_Flush(t *testing.T) {
 		}
 	})
 }
+
+func TestShardedCache_Update(t *testing.T) {
+	t.Run("Update an item in the sharded cache", func(t *testing.T) {
+		sc := setupShardedCache()
+		sc.Set("key1", 1, NoExpiration)
+		sc.Update("key1", func(old any, found bool) (any, time.Duration, bool) {
+			return old.(int) + 1, NoExpiration, true
+		})
+
+		val, found := sc.Get("key1")
+		assert.True(t, found)
+		assert.Equal(t, 2, val)
+	})
+}
+
+func TestShardedCache_CompareAndSwap(t *testing.T) {
+	t.Run("Compare and swap an item in the sharded cache", func(t *testing.T) {
+		sc := setupShardedCache()
+		sc.Set("key1", "value1", NoExpiration)
+
+		assert.False(t, sc.CompareAndSwap("key1", "other", "value2"))
+		assert.True(t, sc.CompareAndSwap("key1", "value1", "value2"))
+
+		val, _ := sc.Get("key1")
+		assert.Equal(t, "value2", val)
+	})
+}
+
+func TestShardedCache_CompareAndDelete(t *testing.T) {
+	t.Run("Compare and delete an item in the sharded cache", func(t *testing.T) {
+		sc := setupShardedCache()
+		sc.Set("key1", "value1", NoExpiration)
+
+		assert.True(t, sc.CompareAndDelete("key1", "value1"))
+
+		_, found := sc.Get("key1")
+		assert.False(t, found)
+	})
+}
+
+func TestShardedCache_GetAndDelete(t *testing.T) {
+	t.Run("Get and delete an item from the sharded cache", func(t *testing.T) {
+		sc := setupShardedCache()
+		sc.Set("key1", "value1", NoExpiration)
+
+		val, found := sc.GetAndDelete("key1")
+		assert.True(t, found)
+		assert.Equal(t, "value1", val)
+
+		_, found = sc.Get("key1")
+		assert.False(t, found)
+	})
+}
+
+func TestShardedCache_GetAndSet(t *testing.T) {
+	t.Run("Get and set an item in the sharded cache", func(t *testing.T) {
+		sc := setupShardedCache()
+		sc.Set("key1", "value1", NoExpiration)
+
+		val, found := sc.GetAndSet("key1", "value2", NoExpiration)
+		assert.True(t, found)
+		assert.Equal(t, "value1", val)
+
+		val, _ = sc.Get("key1")
+		assert.Equal(t, "value2", val)
+	})
+}
+
+func TestShardedCache_GetEx(t *testing.T) {
+	t.Run("Get an item and reset its expiration in the sharded cache", func(t *testing.T) {
+		sc := setupShardedCache()
+		sc.Set("key1", "value1", 5*time.Millisecond)
+
+		val, found := sc.GetEx("key1", NoExpiration)
+		assert.True(t, found)
+		assert.Equal(t, "value1", val)
+
+		time.Sleep(10 * time.Millisecond)
+		_, found = sc.Get("key1")
+		assert.True(t, found)
+	})
+}
+
+func TestShardedCache_Batch(t *testing.T) {
+	t.Run("Set, get and delete many items across shards", func(t *testing.T) {
+		sc := newShardedCache(4, DefaultExpiration)
+		items := map[string]any{}
+		for _, k := range shardedKeys {
+			items[k] = k + "-value"
+		}
+
+		sc.SetMany(items, NoExpiration)
+		assert.Equal(t, items, sc.GetMany(shardedKeys))
+
+		sc.DeleteMany(shardedKeys[:5])
+		got := sc.GetMany(shardedKeys)
+		assert.Len(t, got, len(shardedKeys)-5)
+		for _, k := range shardedKeys[:5] {
+			assert.NotContains(t, got, k)
+		}
+	})
+}
+
+func TestShardedCache_Txn(t *testing.T) {
+	t.Run("Commit writes across shards", func(t *testing.T) {
+		sc := newShardedCache(8, DefaultExpiration)
+		sc.Set("a", 100, NoExpiration)
+		sc.Set("b", 0, NoExpiration)
+
+		err := sc.Txn([]string{"a", "b"}, func(tx *Tx) error {
+			return transfer(tx, "a", "b", 40)
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"a": 60, "b": 40}, sc.GetMany([]string{"a", "b"}))
+	})
+
+	t.Run("Fail when using an undeclared key", func(t *testing.T) {
+		sc := newShardedCache(8, DefaultExpiration)
+
+		err := sc.Txn([]string{"a"}, func(tx *Tx) error {
+			tx.Set("a", 1, NoExpiration)
+			tx.Set("b", 1, NoExpiration)
+			return nil
+		})
+
+		assert.ErrorIs(t, err, ErrUndeclaredKey)
+		_, found := sc.Get("a")
+		assert.False(t, found)
+	})
+
+	t.Run("Abort when a watched key was modified", func(t *testing.T) {
+		sc := newShardedCache(8, DefaultExpiration)
+		sc.Set("a", 1, NoExpiration)
+		w := sc.Watch("a")
+		sc.Set("a", 2, NoExpiration)
+
+		err := sc.Txn(nil, func(tx *Tx) error {
+			tx.Set("a", 3, NoExpiration)
+			return nil
+		}, w)
+
+		assert.ErrorIs(t, err, ErrConflict)
+		val, _ := sc.Get("a")
+		assert.Equal(t, 2, val)
+	})
+
+	t.Run("Concurrent transactions in opposite directions do not deadlock", func(t *testing.T) {
+		sc := newShardedCache(8, DefaultExpiration)
+		sc.SetMany(map[string]any{"a": 1000, "b": 1000}, NoExpiration)
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 100; i++ {
+				_ = sc.Txn([]string{"a", "b"}, func(tx *Tx) error { return transfer(tx, "a", "b", 1) })
+			}
+			close(done)
+		}()
+		for i := 0; i < 100; i++ {
+			_ = sc.Txn([]string{"b", "a"}, func(tx *Tx) error { return transfer(tx, "b", "a", 1) })
+		}
+		<-done
+
+		assert.Equal(t, map[string]any{"a": 1000, "b": 1000}, sc.GetMany([]string{"a", "b"}))
+	})
+}
+
+func TestShardedCache_SetIfVersion(t *testing.T) {
+	t.Run("Set an item only if its version matches in the sharded cache", func(t *testing.T) {
+		sc := setupShardedCache()
+		sc.Set("key1", "value1", NoExpiration)
+		_, version, found := sc.GetWithVersion("key1")
+		assert.True(t, found)
+
+		assert.NoError(t, sc.SetIfVersion("key1", "value2", NoExpiration, version))
+		assert.ErrorIs(t, sc.SetIfVersion("key1", "value3", NoExpiration, version), ErrConflict)
+
+		val, _ := sc.Get("key1")
+		assert.Equal(t, "value2", val)
+	})
+}
+
+func TestShardedCache_IncrementOrInit(t *testing.T) {
+	t.Run("Create and increment counters in the sharded cache", func(t *testing.T) {
+		sc := setupShardedCache()
+
+		i, err := sc.IncrementOrInitInt64("int", 1, 0, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), i)
+
+		u, err := sc.IncrementOrInitUint64("uint", 2, 1, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(3), u)
+
+		f, err := sc.IncrementOrInitFloat64("float", 0.5, 0, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, 0.5, f)
+
+		i, err = sc.IncrementOrInitInt64("int", 1, 0, NoExpiration)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), i)
+	})
+}
@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// A sharded snapshot holds one section per shard. Each section is a snapshot
+// of the shard as written by Cache.SaveWithOptions, so it has its own header
+// and checksum. The shards are saved in parallel, and the sections are
+// interleaved in the stream as they are written.
+//
+// The stream starts with the magic bytes, the big-endian uint16 version and
+// the big-endian uint32 number of sections. It is followed by frames, each a
+// big-endian uint32 section index, a big-endian uint32 length and that many
+// bytes of the section, and ends with a frame with the index shardedEnd and
+// no length.
+const shardedSnapshotVersion = 1
+
+var shardedSnapshotMagic = [8]byte{'G', 'O', 'S', 'H', 'A', 'R', 'D', 0}
+
+const shardedEnd = math.MaxUint32
+
+// Save Write the items of all shards to an io.Writer, like Cache.Save.
+func (sc *shardedCache) Save(w io.Writer) error {
+	return sc.SaveWithOptions(w, SaveOptions{})
+}
+
+// SaveWithOptions Write the items of all shards to an io.Writer, like
+// Cache.SaveWithOptions. The shards are encoded in parallel.
+func (sc *shardedCache) SaveWithOptions(w io.Writer, opts SaveOptions) error {
+	bw := bufio.NewWriter(w)
+	bw.Write(shardedSnapshotMagic[:])
+	binary.Write(bw, binary.BigEndian, uint16(shardedSnapshotVersion))
+	binary.Write(bw, binary.BigEndian, uint32(len(sc.cs)))
+
+	sw := &sectionWriter{w: bw}
+	errs := make([]error, len(sc.cs))
+	var wg sync.WaitGroup
+	for i, c := range sc.cs {
+		wg.Add(1)
+		go func(i int, c *Cache) {
+			defer wg.Done()
+			errs[i] = c.SaveWithOptions(section{sw, uint32(i)}, opts)
+		}(i, c)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if sw.err != nil {
+		return sw.err
+	}
+	binary.Write(bw, binary.BigEndian, uint32(shardedEnd))
+	return bw.Flush()
+}
+
+// sectionWriter writes the frames of all sections to w.
+type sectionWriter struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error
+}
+
+// section writes the frames of one section.
+type section struct {
+	sw    *sectionWriter
+	index uint32
+}
+
+func (s section) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	sw := s.sw
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	var head [8]byte
+	binary.BigEndian.PutUint32(head[:4], s.index)
+	binary.BigEndian.PutUint32(head[4:], uint32(len(p)))
+	sw.w.Write(head[:])
+	if _, err := sw.w.Write(p); err != nil {
+		sw.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SaveFile Save the items of all shards to the given filename, like
+// Cache.SaveFile.
+func (sc *shardedCache) SaveFile(fname string) error {
+	return writeFileAtomic(fname, sc.Save)
+}
+
+// SaveFileWithOptions Save the items of all shards to the given filename like
+// SaveFile, as configured by opts, like Cache.SaveFileWithOptions.
+func (sc *shardedCache) SaveFileWithOptions(fname string, opts SaveOptions) error {
+	return writeFileAtomic(fname, func(w io.Writer) error {
+		return sc.SaveWithOptions(w, opts)
+	})
+}
+
+// Load Add items from an io.Reader, like Cache.Load. The snapshot may have
+// been saved by a sharded cache with a different number of shards or in
+// another process: every item is stored in the shard its key belongs to in
+// this cache. The sections are decoded in parallel, and the whole snapshot is
+// validated before any item is added.
+func (sc *shardedCache) Load(r io.Reader) error {
+	return sc.LoadWithOptions(r, LoadOptions{})
+}
+
+// LoadWithOptions Add items from an io.Reader like Load, as configured by opts,
+// like Cache.LoadWithOptions.
+func (sc *shardedCache) LoadWithOptions(r io.Reader, opts LoadOptions) error {
+	if opts.Codec == nil {
+		opts.Codec = GobCodec
+	}
+	br := bufio.NewReader(r)
+	var head struct {
+		Magic    [8]byte
+		Version  uint16
+		Sections uint32
+	}
+	if err := binary.Read(br, binary.BigEndian, &head); err != nil || head.Magic != shardedSnapshotMagic {
+		return fmt.Errorf("%w: not a sharded snapshot", ErrInvalidSnapshot)
+	}
+	if head.Version != shardedSnapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, head.Version)
+	}
+	if head.Sections == 0 || head.Sections > maxSections {
+		return fmt.Errorf("%w: %d sections", ErrInvalidSnapshot, head.Sections)
+	}
+
+	sections := make([]loadedSection, head.Sections)
+	pipes := make([]*io.PipeWriter, head.Sections)
+	var wg sync.WaitGroup
+	for i := range sections {
+		pr, pw := io.Pipe()
+		pipes[i] = pw
+		wg.Add(1)
+		go func(s *loadedSection) {
+			defer wg.Done()
+			s.info, s.items, s.err = decodeSnapshot(pr, opts)
+			// Stop the frames of a failed section from blocking, and read
+			// anything after the end of the section.
+			if s.err != nil {
+				pr.CloseWithError(s.err)
+			} else {
+				io.Copy(io.Discard, pr)
+			}
+		}(&sections[i])
+	}
+	err := demuxSections(br, pipes)
+	for _, pw := range pipes {
+		pw.CloseWithError(err)
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	for i, s := range sections {
+		if s.err != nil {
+			return fmt.Errorf("Section %d: %w", i, s.err)
+		}
+	}
+
+	for _, s := range sections {
+		byShard := make(map[*Cache]map[string]Item)
+		for k, item := range s.items {
+			c := sc.bucket(k)
+			if byShard[c] == nil {
+				byShard[c] = make(map[string]Item)
+			}
+			byShard[c][k] = item
+		}
+		for c, items := range byShard {
+			c.loadItems(s.info, items, opts)
+		}
+	}
+	return nil
+}
+
+// maxSections bounds the number of sections of a sharded snapshot, so that a
+// corrupt header doesn't start millions of decoders.
+const maxSections = 1 << 16
+
+type loadedSection struct {
+	info  SnapshotInfo
+	items map[string]Item
+	err   error
+}
+
+// demuxSections copies the frames read from r into the pipes of their
+// sections, until the end frame.
+func demuxSections(r io.Reader, pipes []*io.PipeWriter) error {
+	var head [8]byte
+	for {
+		if _, err := io.ReadFull(r, head[:4]); err != nil {
+			return fmt.Errorf("%w: truncated", ErrInvalidSnapshot)
+		}
+		index := binary.BigEndian.Uint32(head[:4])
+		if index == shardedEnd {
+			return nil
+		}
+		if index >= uint32(len(pipes)) {
+			return fmt.Errorf("%w: section %d out of range", ErrInvalidSnapshot, index)
+		}
+		if _, err := io.ReadFull(r, head[4:]); err != nil {
+			return fmt.Errorf("%w: truncated", ErrInvalidSnapshot)
+		}
+		frame := &io.LimitedReader{R: r, N: int64(binary.BigEndian.Uint32(head[4:]))}
+		// A section whose decoder failed returns its error from Write; the
+		// rest of its frames are skipped.
+		if _, err := io.Copy(pipes[index], frame); err != nil {
+			io.Copy(io.Discard, frame)
+		}
+		if frame.N > 0 {
+			return fmt.Errorf("%w: truncated", ErrInvalidSnapshot)
+		}
+	}
+}
+
+// LoadFile Load and add items from the given filename, like Load.
+func (sc *shardedCache) LoadFile(fname string) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return sc.Load(fp)
+}
+
+// LoadFileWithOptions Add items from the given filename like LoadFile, as
+// configured by opts, like Cache.LoadFileWithOptions.
+func (sc *shardedCache) LoadFileWithOptions(fname string, opts LoadOptions) error {
+	fp, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return sc.LoadWithOptions(fp, opts)
+}
+
+func isShardedSnapshot(br *bufio.Reader) bool {
+	magic, _ := br.Peek(len(shardedSnapshotMagic))
+	return bytes.Equal(magic, shardedSnapshotMagic[:])
+}
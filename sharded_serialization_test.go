@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedCache_Save(t *testing.T) {
+	const n = 5 * saveChunkSize
+	newCache := func(shards int) *unexportedShardedCache {
+		sc := unexportedNewSharded(DefaultExpiration, 0, shards)
+		for i := 0; i < n; i++ {
+			sc.Set(fmt.Sprintf("key%d", i), i, NoExpiration)
+		}
+		return sc
+	}
+	save := func(t *testing.T, opts SaveOptions) []byte {
+		var buf bytes.Buffer
+		assert.NoError(t, newCache(8).SaveWithOptions(&buf, opts))
+		return buf.Bytes()
+	}
+	assertLoaded := func(t *testing.T, sc *unexportedShardedCache) {
+		count := 0
+		for i, items := range sc.Items() {
+			count += len(items)
+			for k := range items {
+				assert.Equal(t, sc.cs[i], sc.bucket(k), k)
+			}
+		}
+		assert.Equal(t, n, count)
+		val, found := sc.Get("key1234")
+		assert.True(t, found)
+		assert.Equal(t, 1234, val)
+	}
+
+	t.Run("Route loaded items to their shard", func(t *testing.T) {
+		data := save(t, SaveOptions{})
+		for _, shards := range []int{1, 8, 13} {
+			sc := unexportedNewSharded(DefaultExpiration, 0, shards)
+			assert.NoError(t, sc.Load(bytes.NewReader(data)))
+			assertLoaded(t, sc)
+		}
+	})
+
+	t.Run("Compress and encrypt the shards", func(t *testing.T) {
+		key := bytes.Repeat([]byte{1}, 16)
+		data := save(t, SaveOptions{Compression: Gzip, Key: key, KeyID: "k"})
+		sc := unexportedNewSharded(DefaultExpiration, 0, 4)
+		err := sc.Load(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrWrongKey)
+		assert.Zero(t, len(sc.Items()[0]))
+
+		opts := LoadOptions{Keys: map[string][]byte{"k": key}}
+		assert.NoError(t, sc.LoadWithOptions(bytes.NewReader(data), opts))
+		assertLoaded(t, sc)
+	})
+
+	t.Run("Save and load files", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "sharded.snapshot")
+		assert.NoError(t, newCache(8).SaveFile(fname))
+		sc := unexportedNewSharded(DefaultExpiration, 0, 3)
+		assert.NoError(t, sc.LoadFile(fname))
+		assertLoaded(t, sc)
+	})
+
+	t.Run("Save and load files with options", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "sharded.snapshot")
+		key := bytes.Repeat([]byte{1}, 16)
+		opts := SaveOptions{Compression: Gzip, Key: key, KeyID: "k"}
+		assert.NoError(t, newCache(8).SaveFileWithOptions(fname, opts))
+
+		sc := unexportedNewSharded(DefaultExpiration, 0, 3)
+		assert.ErrorIs(t, sc.LoadFile(fname), ErrWrongKey)
+		assert.NoError(t, sc.LoadFileWithOptions(fname, LoadOptions{Keys: map[string][]byte{"k": key}}))
+		assertLoaded(t, sc)
+	})
+
+	t.Run("Reject invalid snapshots", func(t *testing.T) {
+		data := save(t, SaveOptions{})
+		corrupt := bytes.Clone(data)
+		corrupt[len(corrupt)/2] ^= 0xff
+		for _, data := range [][]byte{data[:len(data)/2], data[:len(data)-1], corrupt, []byte("GOSHARD")} {
+			sc := unexportedNewSharded(DefaultExpiration, 0, 4)
+			err := sc.Load(bytes.NewReader(data))
+			assert.ErrorIs(t, err, ErrInvalidSnapshot)
+			for _, items := range sc.Items() {
+				assert.Empty(t, items)
+			}
+		}
+
+		err := New(DefaultExpiration, 0).Load(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrInvalidSnapshot)
+		assert.ErrorContains(t, err, "sharded cache")
+		var buf bytes.Buffer
+		assert.NoError(t, New(DefaultExpiration, 0).Save(&buf))
+		assert.ErrorIs(t, unexportedNewSharded(DefaultExpiration, 0, 4).Load(&buf), ErrInvalidSnapshot)
+	})
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+)
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".gob"
+	// snapshotTimeFormat sorts lexicographically in chronological order.
+	snapshotTimeFormat = "20060102T150405.000000000Z"
+)
+
+// SaveSnapshot saves the cache's items, as SaveFile does, to a new file in dir
+// named after the current time, and removes all but the newest keep snapshots
+// in dir. If keep is less than one, no snapshots are removed. Returns the path
+// of the new snapshot.
+func (c *Cache) SaveSnapshot(dir string, keep int) (string, error) {
+	return c.SaveSnapshotWithOptions(dir, keep, SaveOptions{})
+}
+
+// SaveSnapshotWithOptions saves the cache's items to a new snapshot in dir
+// like SaveSnapshot, encoding, compressing and encrypting them as configured
+// by opts, as SaveFileWithOptions does.
+func (c *Cache) SaveSnapshotWithOptions(dir string, keep int, opts SaveOptions) (string, error) {
+	fname := filepath.Join(dir, snapshotPrefix+time.Now().UTC().Format(snapshotTimeFormat)+snapshotSuffix)
+	if err := c.SaveFileWithOptions(fname, opts); err != nil {
+		return "", err
+	}
+	if keep < 1 {
+		return fname, nil
+	}
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return fname, err
+	}
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			return fname, err
+		}
+		snapshots = snapshots[1:]
+	}
+	return fname, nil
+}
+
+// LoadLatest Load and add cache items from the newest snapshot saved in dir by
+// SaveSnapshot, like LoadFile. Returns an error wrapping os.ErrNotExist if dir
+// has no snapshots.
+func (c *Cache) LoadLatest(dir string) error {
+	return c.LoadLatestWithOptions(dir, LoadOptions{})
+}
+
+// LoadLatestWithOptions Load and add cache items from the newest snapshot saved
+// in dir like LoadLatest, decrypting, decompressing and decoding them as
+// configured by opts, as LoadFileWithOptions does.
+func (c *Cache) LoadLatestWithOptions(dir string, opts LoadOptions) error {
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("No snapshots in %s: %w", dir, os.ErrNotExist)
+	}
+	return c.LoadFileWithOptions(snapshots[len(snapshots)-1], opts)
+}
+
+// listSnapshots returns the paths of the snapshots in dir, oldest first.
+func listSnapshots(dir string) ([]string, error) {
+	snapshots, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*"+snapshotSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// writeFileAtomic writes fname with write, going through a temporary file in
+// the same directory that is synced and renamed over fname, after which the
+// directory is synced too. Either the old or the new contents of fname
+// survive a crash.
+func writeFileAtomic(fname string, write func(io.Writer) error) (err error) {
+	dir := filepath.Dir(fname)
+	fp, err := os.CreateTemp(dir, "."+filepath.Base(fname)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			fp.Close()
+			os.Remove(fp.Name())
+		}
+	}()
+	if err = fp.Chmod(0o644); err != nil {
+		return err
+	}
+	if err = write(fp); err != nil {
+		return err
+	}
+	if err = fp.Sync(); err != nil {
+		return err
+	}
+	if err = fp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(fp.Name(), fname); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a rename in dir durable. Directories can't be synced on
+// Windows, where renames are durable once they return.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
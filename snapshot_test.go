@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_SaveFile_Atomic(t *testing.T) {
+	t.Run("Keep the previous file when a save fails", func(t *testing.T) {
+		dir := t.TempDir()
+		fname := filepath.Join(dir, "cache.gob")
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+		assert.NoError(t, c.SaveFile(fname))
+
+		errDisk := errors.New("disk full")
+		err := writeFileAtomic(fname, func(w io.Writer) error {
+			_, _ = w.Write([]byte("partial"))
+			return errDisk
+		})
+		assert.ErrorIs(t, err, errDisk)
+
+		loaded := New(DefaultExpiration, 0)
+		assert.NoError(t, loaded.LoadFile(fname))
+		val, _ := loaded.Get("key1")
+		assert.Equal(t, "value1", val)
+		entries, _ := os.ReadDir(dir)
+		assert.Len(t, entries, 1)
+	})
+}
+
+func TestCache_SaveSnapshot(t *testing.T) {
+	t.Run("Keep the newest snapshots", func(t *testing.T) {
+		dir := t.TempDir()
+		c := New(DefaultExpiration, 0)
+		var saved []string
+		for i := 0; i < 4; i++ {
+			c.Set("key1", i, NoExpiration)
+			fname, err := c.SaveSnapshot(dir, 2)
+			assert.NoError(t, err)
+			saved = append(saved, fname)
+			time.Sleep(time.Millisecond)
+		}
+
+		snapshots, err := listSnapshots(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, saved[2:], snapshots)
+	})
+
+	t.Run("Load the newest snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "old", NoExpiration)
+		_, err := c.SaveSnapshot(dir, 0)
+		assert.NoError(t, err)
+		time.Sleep(time.Millisecond)
+		c.Set("key1", "new", NoExpiration)
+		_, err = c.SaveSnapshot(dir, 0)
+		assert.NoError(t, err)
+
+		loaded := New(DefaultExpiration, 0)
+		assert.NoError(t, loaded.LoadLatest(dir))
+		val, _ := loaded.Get("key1")
+		assert.Equal(t, "new", val)
+	})
+
+	t.Run("Save and load snapshots with options", func(t *testing.T) {
+		dir := t.TempDir()
+		key := bytes.Repeat([]byte{1}, 16)
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+		fname, err := c.SaveSnapshotWithOptions(dir, 1, SaveOptions{Compression: Gzip, Key: key, KeyID: "k"})
+		assert.NoError(t, err)
+
+		fp, err := os.Open(fname)
+		assert.NoError(t, err)
+		info, err := ReadSnapshotInfo(fp)
+		fp.Close()
+		assert.NoError(t, err)
+		assert.True(t, info.Encrypted)
+		assert.Equal(t, "gzip", info.Compression)
+
+		loaded := New(DefaultExpiration, 0)
+		assert.ErrorIs(t, loaded.LoadLatest(dir), ErrWrongKey)
+		assert.NoError(t, loaded.LoadLatestWithOptions(dir, LoadOptions{Keys: map[string][]byte{"k": key}}))
+		val, _ := loaded.Get("key1")
+		assert.Equal(t, "value1", val)
+	})
+
+	t.Run("LoadLatest without snapshots", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		assert.ErrorIs(t, c.LoadLatest(t.TempDir()), os.ErrNotExist)
+	})
+}
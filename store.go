@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Store is a backing key-value store kept in sync with the cache, e.g. a
+// database the cache sits in front of. See SetStore.
+type Store interface {
+	// Load fetches the value for k, like a Loader, so a Store can also be
+	// passed to SetLoader as s.Load.
+	Load(k string) (any, time.Duration, error)
+	// Store saves the value for k. d is the item's remaining lifetime, or
+	// NoExpiration if it never expires.
+	Store(k string, x any, d time.Duration) error
+	// Delete removes k.
+	Delete(k string) error
+}
+
+// WriteMode selects how writes to the cache reach its Store.
+type WriteMode int
+
+const (
+	// WriteThrough writes every change to the store synchronously, while the
+	// cache's lock is held, so the store sees changes in the same order as the
+	// cache.
+	WriteThrough WriteMode = iota
+	// WriteBehind queues changes and flushes them in the background. Several
+	// changes to the same key between flushes are coalesced into one.
+	WriteBehind
+)
+
+const (
+	defaultFlushInterval = time.Second
+	defaultMaxPending    = 10000
+	defaultMaxRetries    = 3
+)
+
+// StoreOptions configures how a cache writes to its Store.
+type StoreOptions struct {
+	Mode WriteMode
+	// FlushInterval is how often write-behind changes are flushed. Defaults to
+	// one second.
+	FlushInterval time.Duration
+	// MaxPending is the maximum number of keys with unflushed write-behind
+	// changes. Once it is reached, the pending changes are flushed right away,
+	// rather than at the next interval, and changes to other keys are dropped
+	// and reported to OnError with ErrStoreBacklog until the flush takes them
+	// from the queue. Failed changes are retried only if there is room left in
+	// the queue. Defaults to 10000.
+	MaxPending int
+	// MaxRetries is the number of times a failed write-behind change is retried
+	// on later flushes before it is dropped. Defaults to 3.
+	MaxRetries int
+	// OnError, if set, is called when a change can't be written to the store:
+	// on every failure in write-through mode, and when a change is dropped in
+	// write-behind mode. It may be called while the cache is locked, so it must
+	// not use the cache.
+	OnError func(k string, err error)
+}
+
+// SetStore makes the cache write its changes to s, replacing any previous
+// store, which is closed as by Close. Items that expire, Flush, and values
+// stored by GetOrLoad are not written to the store. s.Load is not used unless
+// it is also passed to SetLoader.
+func (c *Cache) SetStore(s Store, opts StoreOptions) {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = defaultMaxPending
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultMaxRetries
+	}
+	b := &storeSync{
+		store:   s,
+		opts:    opts,
+		pending: make(map[string]*pendingWrite),
+		kick:    make(chan struct{}, 1),
+	}
+	c.mu.Lock()
+	old := c.store
+	c.store = b
+	c.mu.Unlock()
+	if old != nil {
+		_ = old.close(c)
+	}
+	if opts.Mode == WriteBehind {
+		b.stop = make(chan struct{})
+		b.done = make(chan struct{})
+		go b.run(c)
+	}
+}
+
+// Close stops the automatic saves of a cache created by NewWithAutoSave,
+// saving it a last time, detaches the cache's store and closes its
+// append-only log, as by CloseAOF. In write-behind mode, pending changes are
+// flushed first, retrying failures up to MaxRetries times; the changes that
+// still fail are returned. Close does nothing if the cache has neither
+// automatic saves, a store nor a log.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	s := c.autoSave
+	c.autoSave = nil
+	c.mu.Unlock()
+	var err error
+	if s != nil {
+		err = s.close(c)
+	}
+	c.mu.Lock()
+	b := c.store
+	c.store = nil
+	c.mu.Unlock()
+	err = errors.Join(err, c.CloseAOF())
+	if b == nil {
+		return err
+	}
+	return errors.Join(b.close(c), err)
+}
+
+// pendingWrite is an unflushed write-behind change. A nil item means the key
+// was deleted.
+type pendingWrite struct {
+	item     *Item
+	attempts int
+}
+
+type storeSync struct {
+	store   Store
+	opts    StoreOptions
+	mu      sync.Mutex
+	pending map[string]*pendingWrite
+	// flushing serializes flushes, so that the changes to a key reach the
+	// store in order.
+	flushing sync.Mutex
+	// kick asks the background flusher to flush right away.
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// written records that item was stored under k. The caller must hold c.mu.
+func (b *storeSync) written(k string, item Item) {
+	b.changed(k, &item)
+}
+
+// deleted records that k was deleted. The caller must hold c.mu.
+func (b *storeSync) deleted(k string) {
+	b.changed(k, nil)
+}
+
+func (b *storeSync) changed(k string, item *Item) {
+	if b.opts.Mode == WriteThrough {
+		if err := b.apply(k, item); err != nil && b.opts.OnError != nil {
+			b.opts.OnError(k, err)
+		}
+		return
+	}
+	b.mu.Lock()
+	_, found := b.pending[k]
+	dropped := !found && len(b.pending) >= b.opts.MaxPending
+	if !dropped {
+		b.pending[k] = &pendingWrite{item: item}
+	}
+	full := len(b.pending) >= b.opts.MaxPending
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+	if dropped && b.opts.OnError != nil {
+		b.opts.OnError(k, ErrStoreBacklog)
+	}
+}
+
+func (b *storeSync) run(c *Cache) {
+	defer close(b.done)
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.flush(c, false)
+		case <-b.kick:
+			b.flush(c, false)
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *storeSync) close(c *Cache) error {
+	if b.opts.Mode == WriteThrough {
+		return nil
+	}
+	close(b.stop)
+	<-b.done
+	var errs []error
+	for i := 1; b.hasPending(); i++ {
+		errs = append(errs, b.flush(c, i >= b.opts.MaxRetries)...)
+	}
+	return errors.Join(errs...)
+}
+
+func (b *storeSync) hasPending() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending) > 0
+}
+
+// flush writes all pending changes to the store. Failed changes are kept for
+// the next flush, unless they have been retried MaxRetries times, final is set
+// or the queue is full, in which case they are dropped and returned. A failed
+// change is dropped silently if the key changed again in the meantime.
+//
+// The pending values are copied while the cache's read lock is held, so that
+// values the cache modifies in place, such as hashes, don't change while they
+// are being stored, but the store is written to without the lock.
+func (b *storeSync) flush(c *Cache, final bool) []error {
+	b.flushing.Lock()
+	defer b.flushing.Unlock()
+	c.mu.RLock()
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[string]*pendingWrite)
+	b.mu.Unlock()
+	for _, w := range pending {
+		if w.item != nil {
+			item := *w.item
+			item.Object = cloneValue(item.Object)
+			w.item = &item
+		}
+	}
+	c.mu.RUnlock()
+
+	var errs []error
+	for k, w := range pending {
+		err := b.apply(k, w.item)
+		if err == nil {
+			continue
+		}
+		w.attempts++
+		if !final && w.attempts <= b.opts.MaxRetries && b.retry(k, w) {
+			continue
+		}
+		if b.opts.OnError != nil {
+			b.opts.OnError(k, err)
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// retry queues a failed change again, unless the key changed since it was
+// taken from the queue. It returns false if the change must be dropped
+// because the queue is full.
+func (b *storeSync) retry(k string, w *pendingWrite) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, found := b.pending[k]; found {
+		return true
+	}
+	if len(b.pending) >= b.opts.MaxPending {
+		return false
+	}
+	b.pending[k] = w
+	return true
+}
+
+func (b *storeSync) apply(k string, item *Item) error {
+	if item == nil {
+		return b.store.Delete(k)
+	}
+	d := NoExpiration
+	if item.Expiration > 0 {
+		d = time.Until(time.Unix(0, item.Expiration))
+		if d <= 0 {
+			return nil
+		}
+	}
+	return b.store.Store(k, item.Object, d)
+}
+
+// cloneValue returns a copy of the value kinds the cache modifies in place,
+// such as the collections of the list, set and hash commands, and x itself
+// for other values.
+func cloneValue(x any) any {
+	switch v := x.(type) {
+	case []string:
+		return slices.Clone(v)
+	case map[string]string:
+		return maps.Clone(v)
+	case StringSet:
+		return maps.Clone(v)
+	case *SortedSet:
+		return v.clone()
+	case *HyperLogLog:
+		return &HyperLogLog{registers: slices.Clone(v.registers)}
+	case *BloomFilter:
+		return &BloomFilter{bits: slices.Clone(v.bits), m: v.m, hashes: v.hashes}
+	}
+	return x
+}
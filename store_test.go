@@ -0,0 +1,335 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errStoreDown = errors.New("store down")
+
+type mapStore struct {
+	mu       sync.Mutex
+	items    map[string]any
+	writes   int
+	failures int
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{items: map[string]any{}}
+}
+
+func (s *mapStore) Load(k string) (any, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.items[k]; ok {
+		return v, DefaultExpiration, nil
+	}
+	return nil, 0, ErrNotFound
+}
+
+func (s *mapStore) Store(k string, x any, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errStoreDown
+	}
+	s.writes++
+	s.items[k] = x
+	return nil
+}
+
+func (s *mapStore) Delete(k string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	delete(s.items, k)
+	return nil
+}
+
+func (s *mapStore) snapshot() (map[string]any, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]any, len(s.items))
+	for k, v := range s.items {
+		m[k] = v
+	}
+	return m, s.writes
+}
+
+// slowStore is a mapStore that takes delay to write a change.
+type slowStore struct {
+	*mapStore
+	delay   time.Duration
+	started atomic.Bool
+}
+
+func (s *slowStore) Store(k string, x any, d time.Duration) error {
+	s.started.Store(true)
+	time.Sleep(s.delay)
+	return s.mapStore.Store(k, x, d)
+}
+
+// hookStore is a mapStore that calls before ahead of writing a change.
+type hookStore struct {
+	*mapStore
+	before func(k string)
+}
+
+func (s *hookStore) Store(k string, x any, d time.Duration) error {
+	s.before(k)
+	return s.mapStore.Store(k, x, d)
+}
+
+func TestCache_SetStore_WriteThrough(t *testing.T) {
+	t.Run("Write changes synchronously", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		c.SetStore(s, StoreOptions{Mode: WriteThrough})
+
+		c.Set("a", 1, NoExpiration)
+		c.Set("b", 2, NoExpiration)
+		assert.NoError(t, c.Increment("a", 1))
+		c.Delete("b")
+
+		items, _ := s.snapshot()
+		assert.Equal(t, map[string]any{"a": 2}, items)
+	})
+
+	t.Run("Expired items stay in the store", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		c.SetStore(s, StoreOptions{Mode: WriteThrough})
+
+		c.Set("a", 1, time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+		c.DeleteExpired()
+
+		items, _ := s.snapshot()
+		assert.Equal(t, map[string]any{"a": 1}, items)
+	})
+
+	t.Run("Loaded values are not written back", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		s.items["a"] = 1
+		c.SetStore(s, StoreOptions{Mode: WriteThrough})
+		c.SetLoader(s.Load, 0)
+
+		val, err := c.GetOrLoad("a")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, val)
+		_, writes := s.snapshot()
+		assert.Zero(t, writes)
+	})
+
+	t.Run("Report failures to OnError", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		s.failures = 1
+		var failed []string
+		c.SetStore(s, StoreOptions{
+			Mode:    WriteThrough,
+			OnError: func(k string, err error) { failed = append(failed, k) },
+		})
+
+		c.Set("a", 1, NoExpiration)
+
+		assert.Equal(t, []string{"a"}, failed)
+		val, _ := c.Get("a")
+		assert.Equal(t, 1, val)
+	})
+}
+
+func TestCache_SetStore_WriteBehind(t *testing.T) {
+	t.Run("Coalesce changes and flush them on Close", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		c.SetStore(s, StoreOptions{Mode: WriteBehind, FlushInterval: time.Hour})
+
+		for i := 0; i < 10; i++ {
+			c.Set("a", i, NoExpiration)
+		}
+		c.Set("b", 1, NoExpiration)
+		c.Delete("b")
+		items, writes := s.snapshot()
+		assert.Empty(t, items)
+		assert.Zero(t, writes)
+
+		assert.NoError(t, c.Close())
+		items, writes = s.snapshot()
+		assert.Equal(t, map[string]any{"a": 9}, items)
+		assert.Equal(t, 2, writes)
+	})
+
+	t.Run("Flush on the interval", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		c.SetStore(s, StoreOptions{Mode: WriteBehind, FlushInterval: time.Millisecond})
+		defer c.Close()
+
+		c.Set("a", 1, NoExpiration)
+
+		assert.Eventually(t, func() bool {
+			items, _ := s.snapshot()
+			return items["a"] == 1
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("Retry failed changes", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		s.failures = 2
+		c.SetStore(s, StoreOptions{Mode: WriteBehind, FlushInterval: time.Millisecond})
+		defer c.Close()
+
+		c.Set("a", 1, NoExpiration)
+
+		assert.Eventually(t, func() bool {
+			items, _ := s.snapshot()
+			return items["a"] == 1
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("Return changes that still fail on Close", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		s.failures = 100
+		var failed []string
+		c.SetStore(s, StoreOptions{
+			Mode:          WriteBehind,
+			FlushInterval: time.Hour,
+			OnError:       func(k string, err error) { failed = append(failed, k) },
+		})
+
+		c.Set("a", 1, NoExpiration)
+
+		assert.ErrorIs(t, c.Close(), errStoreDown)
+		assert.Equal(t, []string{"a"}, failed)
+		assert.Equal(t, 100-defaultMaxRetries, s.failures)
+	})
+
+	t.Run("Flush when too many changes are pending", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		c.SetStore(s, StoreOptions{Mode: WriteBehind, FlushInterval: time.Hour, MaxPending: 2})
+		defer c.Close()
+
+		c.Set("a", 1, NoExpiration)
+		_, writes := s.snapshot()
+		assert.Zero(t, writes)
+		c.Set("b", 2, NoExpiration)
+		assert.Eventually(t, func() bool {
+			items, _ := s.snapshot()
+			return len(items) == 2
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("Drop changes to new keys while the queue is full", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := &slowStore{mapStore: newMapStore(), delay: 100 * time.Millisecond}
+		var dropped []string
+		c.SetStore(s, StoreOptions{
+			Mode:          WriteBehind,
+			FlushInterval: time.Hour,
+			MaxPending:    2,
+			OnError: func(k string, err error) {
+				assert.ErrorIs(t, err, ErrStoreBacklog)
+				dropped = append(dropped, k)
+			},
+		})
+
+		c.Set("a", 1, NoExpiration)
+		c.Set("b", 2, NoExpiration)
+		assert.Eventually(t, func() bool { return s.started.Load() }, time.Second, time.Millisecond)
+
+		c.Set("c", 3, NoExpiration)
+		c.Set("d", 4, NoExpiration)
+		c.Set("e", 5, NoExpiration)
+		c.Set("c", 6, NoExpiration)
+		assert.Equal(t, []string{"e"}, dropped)
+
+		assert.NoError(t, c.Close())
+		items, _ := s.snapshot()
+		assert.Equal(t, map[string]any{"a": 1, "b": 2, "c": 6, "d": 4}, items)
+	})
+
+	t.Run("Drop failed changes when the queue is full", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := &hookStore{mapStore: newMapStore()}
+		s.failures = 100
+		s.before = func(k string) {
+			if k == "a" {
+				c.Set("b", 2, NoExpiration)
+			}
+		}
+		var mu sync.Mutex
+		failed := map[string]error{}
+		c.SetStore(s, StoreOptions{
+			Mode:          WriteBehind,
+			FlushInterval: time.Hour,
+			MaxPending:    1,
+			OnError: func(k string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed[k] = err
+			},
+		})
+		defer c.Close()
+
+		c.Set("a", 1, NoExpiration)
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return failed["a"] != nil
+		}, time.Second, time.Millisecond)
+		mu.Lock()
+		assert.ErrorIs(t, failed["a"], errStoreDown)
+		mu.Unlock()
+	})
+
+	t.Run("Writers are not blocked while changes are flushed", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := &slowStore{mapStore: newMapStore(), delay: 200 * time.Millisecond}
+		c.SetStore(s, StoreOptions{Mode: WriteBehind, FlushInterval: time.Millisecond})
+		defer c.Close()
+
+		c.Set("a", 1, NoExpiration)
+		assert.Eventually(t, func() bool { return s.started.Load() }, time.Second, time.Millisecond)
+
+		start := time.Now()
+		c.Set("b", 2, NoExpiration)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("Store a copy of values modified in place", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		c.SetStore(s, StoreOptions{Mode: WriteBehind, FlushInterval: time.Hour})
+
+		_, _ = c.HSet("h", "a", "1")
+		assert.NoError(t, c.Close())
+		_, _ = c.HSet("h", "b", "2")
+
+		items, _ := s.snapshot()
+		assert.Equal(t, map[string]string{"a": "1"}, items["h"])
+	})
+
+	t.Run("Stop writing to the store after Close", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		s := newMapStore()
+		c.SetStore(s, StoreOptions{Mode: WriteBehind, FlushInterval: time.Hour})
+		assert.NoError(t, c.Close())
+
+		c.Set("a", 1, NoExpiration)
+
+		assert.NoError(t, c.Close())
+		items, _ := s.snapshot()
+		assert.Empty(t, items)
+	})
+}
@@ -0,0 +1,338 @@
+package tiered
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// headerSize is the size of the header preceding every record in a segment:
+// the length of the payload and its CRC-32, both little-endian uint32s.
+const headerSize = 8
+
+// maxRecordBytes bounds the size of a record's payload, so that a corrupt
+// length can't make a read allocate an arbitrary amount of memory.
+const maxRecordBytes = 1 << 30
+
+var errCorrupt = errors.New("tiered: corrupt record")
+
+// record is the payload of a segment record. Deleted records mask any earlier
+// record for the same key.
+type record struct {
+	Key        string
+	Object     any
+	Expiration int64
+	Deleted    bool
+}
+
+// location is where the latest record for a key lives.
+type location struct {
+	segment    int
+	offset     int64
+	size       int64
+	expiration int64
+}
+
+// diskStore is an append-only log of records split into numbered segment
+// files. An in-memory index maps every key to its latest record, and is
+// rebuilt from the segments when the store is opened.
+//
+// Records that were replaced or deleted stay in their segment until it is
+// compacted: once they take up more than half of the store, and more than a
+// segment, the live records of the oldest segment are copied to the active one
+// and the oldest segment is removed. When the segments grow beyond maxBytes,
+// the oldest ones are removed along with the items in them.
+type diskStore struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64
+	files        map[int]*os.File
+	sizes        map[int]int64
+	ids          []int
+	// total is the size of all segments, and live the size of the records
+	// in the index.
+	total int64
+	live  int64
+	index map[string]location
+}
+
+func openDisk(dir string, segmentBytes, maxBytes int64) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+	s := &diskStore{
+		dir:          dir,
+		segmentBytes: segmentBytes,
+		maxBytes:     maxBytes,
+		files:        make(map[int]*os.File),
+		sizes:        make(map[int]int64),
+		index:        make(map[string]location),
+	}
+	for _, name := range names {
+		var id int
+		if _, err := fmt.Sscanf(filepath.Base(name), "%08d.seg", &id); err == nil {
+			s.ids = append(s.ids, id)
+		}
+	}
+	sort.Ints(s.ids)
+	for _, id := range s.ids {
+		if err := s.openSegment(id); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	if len(s.ids) == 0 {
+		if err := s.addSegment(1); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *diskStore) segmentPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%08d.seg", id))
+}
+
+// openSegment opens an existing segment and adds its records to the index. A
+// torn or corrupt record, e.g. from a crash in the middle of a write, ends the
+// segment: it is truncated there.
+func (s *diskStore) openSegment(id int) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	s.files[id] = f
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var offset int64
+	for {
+		rec, size, err := readRecord(f, offset, info.Size()-offset)
+		if err != nil {
+			break
+		}
+		if rec.Deleted {
+			s.unindex(rec.Key)
+		} else {
+			s.setIndex(rec.Key, location{segment: id, offset: offset, size: size, expiration: rec.Expiration})
+		}
+		offset += size
+	}
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	s.sizes[id] = offset
+	s.total += offset
+	return nil
+}
+
+func (s *diskStore) addSegment(id int) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	s.files[id] = f
+	s.sizes[id] = 0
+	s.ids = append(s.ids, id)
+	return nil
+}
+
+// readRecord reads the record at offset, which must fit in the next size
+// bytes of r.
+func readRecord(r io.ReaderAt, offset, size int64) (record, int64, error) {
+	var rec record
+	var header [headerSize]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return rec, 0, err
+	}
+	length := binary.LittleEndian.Uint32(header[:4])
+	if length > maxRecordBytes || headerSize+int64(length) > size {
+		return rec, 0, errCorrupt
+	}
+	payload := make([]byte, length)
+	if _, err := r.ReadAt(payload, offset+headerSize); err != nil {
+		return rec, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+		return rec, 0, errCorrupt
+	}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+		return rec, 0, err
+	}
+	return rec, headerSize + int64(length), nil
+}
+
+// append writes rec to the active segment and indexes it, then compacts and
+// trims the store. The caller must remove the record's key from the index
+// first, so that compacting doesn't copy an older record after it.
+func (s *diskStore) append(rec record) error {
+	loc, err := s.write(rec)
+	if err != nil {
+		return err
+	}
+	if !rec.Deleted {
+		s.setIndex(rec.Key, loc)
+	}
+	if err := s.compact(); err != nil {
+		return err
+	}
+	return s.trim()
+}
+
+// write writes rec to the active segment, starting a new one if it is full,
+// and returns the record's location.
+func (s *diskStore) write(rec record) (location, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, headerSize))
+	if err := gob.NewEncoder(&buf).Encode(&rec); err != nil {
+		return location{}, err
+	}
+	b := buf.Bytes()
+	if len(b)-headerSize > maxRecordBytes {
+		return location{}, fmt.Errorf("tiered: item %s is larger than %d bytes", rec.Key, maxRecordBytes)
+	}
+	binary.LittleEndian.PutUint32(b[:4], uint32(len(b)-headerSize))
+	binary.LittleEndian.PutUint32(b[4:headerSize], crc32.ChecksumIEEE(b[headerSize:]))
+
+	id := s.ids[len(s.ids)-1]
+	if s.sizes[id] > 0 && s.sizes[id]+int64(len(b)) > s.segmentBytes {
+		id++
+		if err := s.addSegment(id); err != nil {
+			return location{}, err
+		}
+	}
+	loc := location{segment: id, offset: s.sizes[id], size: int64(len(b)), expiration: rec.Expiration}
+	if _, err := s.files[id].WriteAt(b, loc.offset); err != nil {
+		return location{}, err
+	}
+	s.sizes[id] += loc.size
+	s.total += loc.size
+	return loc, nil
+}
+
+// compact removes the oldest segment, after copying its live records to the
+// active segment, if the records that were replaced or deleted take up more
+// than half of the store and more than a segment. Deletion records in the
+// oldest segment are dropped, since there is no older record for them to
+// mask. Expired items are dropped too.
+func (s *diskStore) compact() error {
+	dead := s.total - s.live
+	if len(s.ids) < 2 || dead <= s.live || dead <= s.segmentBytes {
+		return nil
+	}
+	id := s.ids[0]
+	now := time.Now().UnixNano()
+	for k, loc := range s.index {
+		if loc.segment != id {
+			continue
+		}
+		if loc.expiration > 0 && now > loc.expiration {
+			s.unindex(k)
+			continue
+		}
+		rec, _, err := readRecord(s.files[id], loc.offset, loc.size)
+		if err != nil {
+			return err
+		}
+		moved, err := s.write(rec)
+		if err != nil {
+			return err
+		}
+		s.setIndex(k, moved)
+	}
+	return s.removeOldest()
+}
+
+// trim removes the oldest segments while the store is larger than maxBytes,
+// keeping at least the active one.
+func (s *diskStore) trim() error {
+	for s.maxBytes > 0 && s.total > s.maxBytes && len(s.ids) > 1 {
+		if err := s.removeOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeOldest removes the oldest segment and the items in it.
+func (s *diskStore) removeOldest() error {
+	id := s.ids[0]
+	s.ids = s.ids[1:]
+	s.total -= s.sizes[id]
+	delete(s.sizes, id)
+	for k, loc := range s.index {
+		if loc.segment == id {
+			s.unindex(k)
+		}
+	}
+	s.files[id].Close()
+	delete(s.files, id)
+	return os.Remove(s.segmentPath(id))
+}
+
+// setIndex points k to the record at loc.
+func (s *diskStore) setIndex(k string, loc location) {
+	s.unindex(k)
+	s.index[k] = loc
+	s.live += loc.size
+}
+
+// unindex removes k from the index.
+func (s *diskStore) unindex(k string) {
+	if loc, found := s.index[k]; found {
+		delete(s.index, k)
+		s.live -= loc.size
+	}
+}
+
+func (s *diskStore) put(k string, x any, expiration int64) error {
+	s.unindex(k)
+	return s.append(record{Key: k, Object: x, Expiration: expiration})
+}
+
+// get returns the unexpired item stored under k.
+func (s *diskStore) get(k string) (record, bool, error) {
+	loc, found := s.index[k]
+	if !found {
+		return record{}, false, nil
+	}
+	if loc.expiration > 0 && time.Now().UnixNano() > loc.expiration {
+		return record{}, false, s.remove(k)
+	}
+	rec, _, err := readRecord(s.files[loc.segment], loc.offset, loc.size)
+	if err != nil {
+		return record{}, false, err
+	}
+	return rec, true, nil
+}
+
+func (s *diskStore) remove(k string) error {
+	if _, found := s.index[k]; !found {
+		return nil
+	}
+	s.unindex(k)
+	return s.append(record{Key: k, Deleted: true})
+}
+
+func (s *diskStore) close() error {
+	var errs []error
+	for _, id := range s.ids {
+		if f, ok := s.files[id]; ok {
+			errs = append(errs, f.Sync(), f.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
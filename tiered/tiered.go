@@ -0,0 +1,191 @@
+// Package tiered provides a two-tier cache for working sets larger than
+// memory. Recently used items are kept in a go-cache Cache (L1), and the least
+// recently used ones are demoted to append-only segment files on local disk
+// (L2). Items found in L2 are promoted back to L1. Items keep their expiration
+// time in both tiers.
+//
+// Items are written to disk with Gob, so the types stored in the cache must be
+// registered with gob.Register.
+package tiered
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pzentenoe/go-cache"
+)
+
+const (
+	defaultMaxMemoryItems = 10000
+	defaultSegmentBytes   = 16 << 20
+)
+
+// Options configures a tiered Cache.
+type Options struct {
+	// Dir is the directory holding the L2 segment files. It is created if it
+	// doesn't exist, and the items in it are available after Open.
+	Dir string
+	// DefaultExpiration has the same meaning as in cache.New.
+	DefaultExpiration time.Duration
+	// MaxMemoryItems is the number of items kept in L1. Defaults to 10000.
+	MaxMemoryItems int
+	// MaxDiskBytes is the size L2 is kept under by removing its oldest
+	// segments, and the items in them, even if they haven't expired. 0 means
+	// no limit. Either way, replaced and deleted items are reclaimed by
+	// compacting the segments once they take up more than half of L2.
+	MaxDiskBytes int64
+	// SegmentBytes is the size at which L2 starts a new segment file. Defaults
+	// to 16 MiB.
+	SegmentBytes int64
+}
+
+// Cache is a two-tier cache. It is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	l1       *cache.Cache
+	lru      *list.List
+	elems    map[string]*list.Element
+	l2       *diskStore
+	maxItems int
+}
+
+// Open returns a tiered cache storing its L2 in opts.Dir, with the items
+// already there.
+func Open(opts Options) (*Cache, error) {
+	if opts.MaxMemoryItems <= 0 {
+		opts.MaxMemoryItems = defaultMaxMemoryItems
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	l2, err := openDisk(opts.Dir, opts.SegmentBytes, opts.MaxDiskBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{
+		l1:       cache.New(opts.DefaultExpiration, 0),
+		lru:      list.New(),
+		elems:    make(map[string]*list.Element),
+		l2:       l2,
+		maxItems: opts.MaxMemoryItems,
+	}, nil
+}
+
+// Set adds an item to L1, replacing any existing item in either tier, with the
+// same meaning for d as in cache.Cache.Set. Returns an error if the item
+// couldn't be removed from L2 or demoting another item failed.
+func (c *Cache) Set(k string, x any, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.l1.Set(k, x, d)
+	if err := c.l2.remove(k); err != nil {
+		return err
+	}
+	return c.touch(k)
+}
+
+// Get returns the item stored under k, promoting it to L1 if it was found in
+// L2. Returns an error if L2 couldn't be read.
+func (c *Cache) Get(k string) (any, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.elems[k]; ok {
+		if x, found := c.l1.Get(k); found {
+			c.lru.MoveToFront(e)
+			return x, true, nil
+		}
+		c.forget(k)
+	}
+
+	rec, found, err := c.l2.get(k)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	if err := c.l2.remove(k); err != nil {
+		return nil, false, err
+	}
+	d := cache.NoExpiration
+	if rec.Expiration > 0 {
+		// The item may have expired since it was read. A duration of zero
+		// or less would mean the default expiration or none to Set.
+		d = time.Until(time.Unix(0, rec.Expiration))
+		if d <= 0 {
+			return nil, false, nil
+		}
+	}
+	c.l1.Set(k, rec.Object, d)
+	return rec.Object, true, c.touch(k)
+}
+
+// Delete removes the item stored under k from both tiers.
+func (c *Cache) Delete(k string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forget(k)
+	return c.l2.remove(k)
+}
+
+// Len returns the number of items in L1 and L2, which may include expired
+// items that haven't been removed yet.
+func (c *Cache) Len() (memory, disk int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len(), len(c.l2.index)
+}
+
+// Close demotes all items in L1 to L2, so that they are available when the
+// directory is opened again, and closes the segment files. The cache must not
+// be used after Close.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for c.lru.Len() > 0 {
+		errs = append(errs, c.demoteOldest())
+	}
+	errs = append(errs, c.l2.close())
+	return errors.Join(errs...)
+}
+
+// touch marks k as the most recently used item in L1 and demotes the least
+// recently used items until L1 is within its limit.
+func (c *Cache) touch(k string) error {
+	if e, ok := c.elems[k]; ok {
+		c.lru.MoveToFront(e)
+	} else {
+		c.elems[k] = c.lru.PushFront(k)
+	}
+	for c.lru.Len() > c.maxItems {
+		if err := c.demoteOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// demoteOldest moves the least recently used item from L1 to L2. Expired
+// items are dropped.
+func (c *Cache) demoteOldest() error {
+	k := c.lru.Back().Value.(string)
+	x, expiration, found := c.l1.GetWithExpiration(k)
+	c.forget(k)
+	if !found {
+		return nil
+	}
+	var exp int64
+	if !expiration.IsZero() {
+		exp = expiration.UnixNano()
+	}
+	return c.l2.put(k, x, exp)
+}
+
+// forget removes k from L1.
+func (c *Cache) forget(k string) {
+	if e, ok := c.elems[k]; ok {
+		c.lru.Remove(e)
+		delete(c.elems, k)
+	}
+	c.l1.Delete(k)
+}
@@ -0,0 +1,203 @@
+package tiered
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pzentenoe/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func open(t *testing.T, opts Options) *Cache {
+	t.Helper()
+	if opts.Dir == "" {
+		opts.Dir = t.TempDir()
+	}
+	c, err := Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCache_Tiers(t *testing.T) {
+	t.Run("Demote the least recently used items to disk", func(t *testing.T) {
+		c := open(t, Options{MaxMemoryItems: 2})
+		defer c.Close()
+
+		assert.NoError(t, c.Set("a", 1, cache.NoExpiration))
+		assert.NoError(t, c.Set("b", 2, cache.NoExpiration))
+		_, _, _ = c.Get("a")
+		assert.NoError(t, c.Set("c", 3, cache.NoExpiration))
+
+		memory, disk := c.Len()
+		assert.Equal(t, 2, memory)
+		assert.Equal(t, 1, disk)
+		_, found := c.l1.Get("b")
+		assert.False(t, found)
+	})
+
+	t.Run("Promote disk hits to memory", func(t *testing.T) {
+		c := open(t, Options{MaxMemoryItems: 1})
+		defer c.Close()
+		assert.NoError(t, c.Set("a", "value1", cache.NoExpiration))
+		assert.NoError(t, c.Set("b", "value2", cache.NoExpiration))
+
+		val, found, err := c.Get("a")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "value1", val)
+		_, found = c.l1.Get("a")
+		assert.True(t, found)
+		_, found = c.l1.Get("b")
+		assert.False(t, found)
+	})
+
+	t.Run("Keep the expiration time across tiers", func(t *testing.T) {
+		c := open(t, Options{MaxMemoryItems: 1})
+		defer c.Close()
+		assert.NoError(t, c.Set("a", 1, time.Hour))
+		_, want, _ := c.l1.GetWithExpiration("a")
+		assert.NoError(t, c.Set("b", 2, 5*time.Millisecond))
+		assert.NoError(t, c.Set("c", 3, cache.NoExpiration))
+
+		_, _, _ = c.Get("a")
+		_, got, _ := c.l1.GetWithExpiration("a")
+		assert.WithinDuration(t, want, got, time.Millisecond)
+
+		time.Sleep(10 * time.Millisecond)
+		_, found, err := c.Get("b")
+		assert.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("Replace and delete items in both tiers", func(t *testing.T) {
+		c := open(t, Options{MaxMemoryItems: 1})
+		defer c.Close()
+		assert.NoError(t, c.Set("a", 1, cache.NoExpiration))
+		assert.NoError(t, c.Set("b", 2, cache.NoExpiration))
+		assert.NoError(t, c.Set("a", 3, cache.NoExpiration))
+
+		val, _, _ := c.Get("a")
+		assert.Equal(t, 3, val)
+
+		assert.NoError(t, c.Delete("a"))
+		assert.NoError(t, c.Delete("b"))
+		_, found, _ := c.Get("a")
+		assert.False(t, found)
+		_, found, _ = c.Get("b")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_Disk(t *testing.T) {
+	t.Run("Reopen the items saved on Close", func(t *testing.T) {
+		dir := t.TempDir()
+		c := open(t, Options{Dir: dir, MaxMemoryItems: 1})
+		assert.NoError(t, c.Set("a", 1, cache.NoExpiration))
+		assert.NoError(t, c.Set("b", 2, cache.NoExpiration))
+		assert.NoError(t, c.Delete("a"))
+		assert.NoError(t, c.Set("c", 3, cache.NoExpiration))
+		assert.NoError(t, c.Close())
+
+		c = open(t, Options{Dir: dir})
+		defer c.Close()
+		_, found, _ := c.Get("a")
+		assert.False(t, found)
+		val, _, _ := c.Get("b")
+		assert.Equal(t, 2, val)
+		val, _, _ = c.Get("c")
+		assert.Equal(t, 3, val)
+	})
+
+	t.Run("Ignore a torn record at the end of a segment", func(t *testing.T) {
+		dir := t.TempDir()
+		c := open(t, Options{Dir: dir, MaxMemoryItems: 1})
+		assert.NoError(t, c.Set("a", 1, cache.NoExpiration))
+		assert.NoError(t, c.Close())
+		fp, err := os.OpenFile(filepath.Join(dir, "00000001.seg"), os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = fp.Write([]byte{42, 0, 0, 0, 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp.Close()
+
+		c = open(t, Options{Dir: dir})
+		defer c.Close()
+		val, _, err := c.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, val)
+	})
+
+	t.Run("Remove the oldest segments beyond the size limit", func(t *testing.T) {
+		c := open(t, Options{MaxMemoryItems: 1, SegmentBytes: 256, MaxDiskBytes: 1024})
+		defer c.Close()
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, c.Set(string(rune('a'+i%26))+string(rune('a'+i/26)), i, cache.NoExpiration))
+		}
+
+		assert.LessOrEqual(t, c.l2.total, int64(1024))
+		_, found, _ := c.Get("aa")
+		assert.False(t, found)
+		val, found, _ := c.Get("vd")
+		assert.True(t, found)
+		assert.Equal(t, 99, val)
+	})
+	t.Run("Compact replaced and deleted items", func(t *testing.T) {
+		dir := t.TempDir()
+		c := open(t, Options{Dir: dir, MaxMemoryItems: 1, SegmentBytes: 256})
+		assert.NoError(t, c.Set("cold", -1, cache.NoExpiration))
+		for i := 0; i < 1000; i++ {
+			assert.NoError(t, c.Set("a", i, cache.NoExpiration))
+			assert.NoError(t, c.Set("b", i, cache.NoExpiration))
+		}
+
+		assert.Less(t, c.l2.total, int64(4*256))
+		assert.NoError(t, c.Close())
+
+		c = open(t, Options{Dir: dir})
+		defer c.Close()
+		for k, want := range map[string]int{"cold": -1, "a": 999, "b": 999} {
+			val, found, err := c.Get(k)
+			assert.NoError(t, err)
+			assert.True(t, found, k)
+			assert.Equal(t, want, val, k)
+		}
+	})
+
+	t.Run("Reject a record longer than its segment", func(t *testing.T) {
+		dir := t.TempDir()
+		c := open(t, Options{Dir: dir, MaxMemoryItems: 1})
+		assert.NoError(t, c.Set("a", 1, cache.NoExpiration))
+		assert.NoError(t, c.Close())
+		fp, err := os.OpenFile(filepath.Join(dir, "00000001.seg"), os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = fp.Write([]byte{0xf0, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1, 2, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp.Close()
+
+		f, err := os.Open(filepath.Join(dir, "00000001.seg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := f.Stat()
+		_, _, err = readRecord(f, info.Size()-11, 11)
+		f.Close()
+		assert.ErrorIs(t, err, errCorrupt)
+
+		c = open(t, Options{Dir: dir})
+		defer c.Close()
+		val, _, err := c.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, val)
+	})
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// WatchSet holds the versions of a set of keys at the time they were watched.
+// Passing it to Txn makes the transaction fail with ErrConflict if any of
+// those keys was set, changed or deleted in the meantime, like Redis WATCH.
+// Unlike Redis, a key that was missing when it was watched and is missing
+// again when the transaction runs counts as unchanged, even if it was created
+// and deleted in the meantime, since deleted keys leave no version behind.
+type WatchSet struct {
+	versions map[string]uint64
+}
+
+// Watch records the current version of the given keys. Keys that don't exist
+// or have expired are watched as missing, so creating them also counts as a
+// modification, as long as they still exist when the transaction runs.
+func (c *Cache) Watch(keys ...string) *WatchSet {
+	w := &WatchSet{versions: make(map[string]uint64, len(keys))}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, k := range keys {
+		w.versions[k] = c.versionOf(k)
+	}
+	return w
+}
+
+func (c *Cache) versionOf(k string) uint64 {
+	item, found := c.lookup(k)
+	if !found {
+		return 0
+	}
+	return item.version
+}
+
+// Tx gives a transaction function access to the cache. Writes are buffered
+// and only applied, all at once, if the function returns nil.
+type Tx struct {
+	bucket func(k string) *Cache
+	writes map[string]txWrite
+	err    error
+}
+
+type txWrite struct {
+	item    Item
+	deleted bool
+}
+
+// Get an item, seeing the writes already made by the transaction. Returns the
+// item or nil, and a bool indicating whether the key was found.
+func (tx *Tx) Get(k string) (any, bool) {
+	if w, ok := tx.writes[k]; ok {
+		if w.deleted {
+			return nil, false
+		}
+		return w.item.Object, true
+	}
+	c := tx.cache(k)
+	if c == nil {
+		return nil, false
+	}
+	return c.get(k)
+}
+
+// Set an item when the transaction commits, with the same expiration rules as
+// Cache.Set.
+func (tx *Tx) Set(k string, x any, d time.Duration) {
+	c := tx.cache(k)
+	if c == nil {
+		return
+	}
+	tx.writes[k] = txWrite{item: Item{Object: x, Expiration: c.expiration(d)}}
+}
+
+// Delete an item when the transaction commits.
+func (tx *Tx) Delete(k string) {
+	if tx.cache(k) == nil {
+		return
+	}
+	tx.writes[k] = txWrite{deleted: true}
+}
+
+func (tx *Tx) cache(k string) *Cache {
+	c := tx.bucket(k)
+	if c == nil && tx.err == nil {
+		tx.err = fmt.Errorf("%w: %s", ErrUndeclaredKey, k)
+	}
+	return c
+}
+
+type evictedItem struct {
+	cache *Cache
+	keyAndValue
+}
+
+// commit applies the buffered writes. The caller must hold the locks of every
+// cache involved.
+func (tx *Tx) commit() []evictedItem {
+	var evictedItems []evictedItem
+	for k, w := range tx.writes {
+		c := tx.bucket(k)
+		if !w.deleted {
+			c.write(k, w.item)
+			continue
+		}
+		if v, evicted := c.delete(k); evicted {
+			evictedItems = append(evictedItems, evictedItem{c, keyAndValue{k, v}})
+		}
+	}
+	return evictedItems
+}
+
+// run checks the watched versions, calls fn and commits its writes. The
+// caller must hold the locks of every cache involved.
+func (tx *Tx) run(fn func(tx *Tx) error, watches []*WatchSet) ([]evictedItem, error) {
+	for _, w := range watches {
+		for k, v := range w.versions {
+			c := tx.cache(k)
+			if c == nil {
+				return nil, tx.err
+			}
+			if c.versionOf(k) != v {
+				return nil, ErrConflict
+			}
+		}
+	}
+	if err := fn(tx); err != nil {
+		return nil, err
+	}
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	return tx.commit(), nil
+}
+
+func notifyEvicted(evictedItems []evictedItem) {
+	for _, v := range evictedItems {
+		if f := v.cache.onEvicted; f != nil {
+			f(v.key, v.value)
+		}
+	}
+}
+
+// Txn runs fn with exclusive access to the cache and applies the writes it
+// makes through tx atomically: other goroutines see either none or all of
+// them. If fn returns an error, the writes are discarded and the error is
+// returned. If any of the watches saw a key that has since been modified, fn
+// is not called and ErrConflict is returned.
+//
+// fn is called with the cache lock held, so it must not call any method on the
+// same cache.
+func (c *Cache) Txn(fn func(tx *Tx) error, watches ...*WatchSet) error {
+	tx := &Tx{
+		bucket: func(string) *Cache { return c },
+		writes: make(map[string]txWrite),
+	}
+	c.mu.Lock()
+	evictedItems, err := func() ([]evictedItem, error) {
+		defer c.mu.Unlock()
+		return tx.run(fn, watches)
+	}()
+	if err != nil {
+		return err
+	}
+	notifyEvicted(evictedItems)
+	return nil
+}
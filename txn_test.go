@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errInsufficientFunds = errors.New("insufficient funds")
+
+func transfer(tx *Tx, from, to string, amount int) error {
+	a, _ := tx.Get(from)
+	b, _ := tx.Get(to)
+	if a.(int) < amount {
+		return errInsufficientFunds
+	}
+	tx.Set(from, a.(int)-amount, NoExpiration)
+	tx.Set(to, b.(int)+amount, NoExpiration)
+	return nil
+}
+
+func TestCache_Txn(t *testing.T) {
+	t.Run("Commit writes to several keys", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("a", 100, NoExpiration)
+		c.Set("b", 0, NoExpiration)
+
+		err := c.Txn(func(tx *Tx) error {
+			return transfer(tx, "a", "b", 40)
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"a": 60, "b": 40}, c.GetMany([]string{"a", "b"}))
+	})
+
+	t.Run("Roll back when the function fails", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("a", 10, NoExpiration)
+		c.Set("b", 0, NoExpiration)
+
+		err := c.Txn(func(tx *Tx) error {
+			tx.Set("c", "value", NoExpiration)
+			return transfer(tx, "a", "b", 40)
+		})
+
+		assert.ErrorIs(t, err, errInsufficientFunds)
+		assert.Equal(t, map[string]any{"a": 10, "b": 0}, c.GetMany([]string{"a", "b", "c"}))
+	})
+
+	t.Run("Reads see the transaction's own writes", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("a", "value", NoExpiration)
+
+		err := c.Txn(func(tx *Tx) error {
+			tx.Delete("a")
+			_, found := tx.Get("a")
+			assert.False(t, found)
+			tx.Set("b", "other", NoExpiration)
+			val, _ := tx.Get("b")
+			assert.Equal(t, "other", val)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		_, found := c.Get("a")
+		assert.False(t, found)
+	})
+
+	t.Run("Deletes call OnEvicted after commit", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		var evicted []string
+		c.OnEvicted(func(k string, v any) {
+			evicted = append(evicted, k)
+		})
+		c.Set("a", 1, NoExpiration)
+
+		err := c.Txn(func(tx *Tx) error {
+			tx.Delete("a")
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a"}, evicted)
+	})
+
+	t.Run("Concurrent transfers keep the total", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("a", 1000, NoExpiration)
+		c.Set("b", 1000, NoExpiration)
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				_ = c.Txn(func(tx *Tx) error { return transfer(tx, "a", "b", 7) })
+			}()
+			go func() {
+				defer wg.Done()
+				_ = c.Txn(func(tx *Tx) error { return transfer(tx, "b", "a", 3) })
+			}()
+		}
+		wg.Wait()
+
+		a, _ := c.Get("a")
+		b, _ := c.Get("b")
+		assert.Equal(t, 2000, a.(int)+b.(int))
+	})
+}
+
+func TestCache_Watch(t *testing.T) {
+	t.Run("Commit when watched keys are unchanged", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("a", 1, NoExpiration)
+		w := c.Watch("a", "missing")
+
+		err := c.Txn(func(tx *Tx) error {
+			tx.Set("a", 2, NoExpiration)
+			return nil
+		}, w)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Abort when a watched key was set", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("a", 1, NoExpiration)
+		w := c.Watch("a")
+		c.Set("a", 1, NoExpiration)
+
+		called := false
+		err := c.Txn(func(tx *Tx) error {
+			called = true
+			return nil
+		}, w)
+
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.False(t, called)
+	})
+
+	t.Run("Abort when a watched key was created or deleted", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("a", 1, NoExpiration)
+		w := c.Watch("a", "b")
+		c.Delete("a")
+
+		assert.ErrorIs(t, c.Txn(func(tx *Tx) error { return nil }, w), ErrConflict)
+
+		w = c.Watch("b")
+		c.Set("b", 1, NoExpiration)
+
+		assert.ErrorIs(t, c.Txn(func(tx *Tx) error { return nil }, w), ErrConflict)
+	})
+
+	t.Run("A missing key that was created and deleted counts as unchanged", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		w := c.Watch("a")
+		c.Set("a", 1, NoExpiration)
+		c.Delete("a")
+
+		assert.NoError(t, c.Txn(func(tx *Tx) error { return nil }, w))
+	})
+
+	t.Run("Abort when a watched item from NewFrom was deleted", func(t *testing.T) {
+		c := NewFrom(DefaultExpiration, 0, map[string]Item{"a": {Object: 1}})
+		w := c.Watch("a")
+		c.Delete("a")
+
+		assert.ErrorIs(t, c.Txn(func(tx *Tx) error { return nil }, w), ErrConflict)
+	})
+
+	t.Run("Watching an expired key sees it as missing", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("a", 1, time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+		w := c.Watch("a")
+		c.DeleteExpired()
+
+		assert.NoError(t, c.Txn(func(tx *Tx) error { return nil }, w))
+	})
+}
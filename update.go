@@ -0,0 +1,71 @@
+package cache
+
+import "time"
+
+// Update atomically reads and rewrites the item stored under k. The function f
+// receives the current value and a bool indicating whether an unexpired item
+// was found, and returns the new value, its expiration duration (with the same
+// meaning as in Set) and whether the item should be kept. If keep is false the
+// item is deleted, and the OnEvicted function is called for the old value.
+//
+// f is called with the cache lock held, so it must not call any method on the
+// same cache.
+func (c *Cache) Update(k string, f func(old any, found bool) (newVal any, d time.Duration, keep bool)) {
+	if v, evicted := c.update(k, f); evicted {
+		c.onEvicted(k, v)
+	}
+}
+
+// update runs Update with the lock held, so that it is released even if f
+// panics, and returns the value to pass to the OnEvicted function, if any.
+func (c *Cache) update(k string, f func(old any, found bool) (newVal any, d time.Duration, keep bool)) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, found := c.get(k)
+	x, d, keep := f(old, found)
+	if keep {
+		c.set(k, x, d)
+		return nil, false
+	}
+	return c.delete(k)
+}
+
+// CompareAndSwap replaces the value stored under k with new if the key exists,
+// hasn't expired, and its current value is equal to old. The item keeps its
+// expiration time. Returns true if the value was swapped. Like sync.Map, the
+// comparison panics if the stored value is not comparable.
+func (c *Cache) CompareAndSwap(k string, old, new any) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, found := c.lookup(k)
+	if !found || item.Object != old {
+		return false
+	}
+	item.Object = new
+	c.write(k, item)
+	return true
+}
+
+// CompareAndDelete deletes the item stored under k if the key exists, hasn't
+// expired, and its current value is equal to old. Returns true if the item was
+// deleted, in which case the OnEvicted function is called as it is by Delete.
+// Like CompareAndSwap, the comparison panics if the stored value is not
+// comparable.
+func (c *Cache) CompareAndDelete(k string, old any) bool {
+	v, evicted, deleted := c.compareAndDelete(k, old)
+	if evicted {
+		c.onEvicted(k, v)
+	}
+	return deleted
+}
+
+func (c *Cache) compareAndDelete(k string, old any) (v any, evicted, deleted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, found := c.lookup(k)
+	if !found || item.Object != old {
+		return nil, false, false
+	}
+	v, evicted = c.delete(k)
+	return v, evicted, true
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type profile struct {
+	Name   string
+	Visits int
+}
+
+func TestCache_Update(t *testing.T) {
+	t.Run("Update a missing item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Update("key1", func(old any, found bool) (any, time.Duration, bool) {
+			assert.Nil(t, old)
+			assert.False(t, found)
+			return "value1", NoExpiration, true
+		})
+
+		val, found := c.Get("key1")
+		assert.True(t, found)
+		assert.Equal(t, "value1", val)
+	})
+
+	t.Run("Update an existing struct item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", profile{Name: "ana"}, NoExpiration)
+		c.Update("key1", func(old any, found bool) (any, time.Duration, bool) {
+			p := old.(profile)
+			p.Visits++
+			return p, NoExpiration, true
+		})
+
+		val, _ := c.Get("key1")
+		assert.Equal(t, profile{Name: "ana", Visits: 1}, val)
+	})
+
+	t.Run("Update treats an expired item as missing", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+		c.Update("key1", func(old any, found bool) (any, time.Duration, bool) {
+			assert.False(t, found)
+			return "value2", NoExpiration, true
+		})
+
+		val, _ := c.Get("key1")
+		assert.Equal(t, "value2", val)
+	})
+
+	t.Run("Update deletes the item when keep is false", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		var evictedKey string
+		c.OnEvicted(func(k string, v any) {
+			evictedKey = k
+		})
+		c.Set("key1", "value1", NoExpiration)
+		c.Update("key1", func(old any, found bool) (any, time.Duration, bool) {
+			return nil, 0, false
+		})
+
+		_, found := c.Get("key1")
+		assert.False(t, found)
+		assert.Equal(t, "key1", evictedKey)
+	})
+
+	t.Run("Concurrent updates are not lost", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Update("key1", func(old any, found bool) (any, time.Duration, bool) {
+					p, _ := old.(profile)
+					p.Visits++
+					return p, NoExpiration, true
+				})
+			}()
+		}
+		wg.Wait()
+
+		val, _ := c.Get("key1")
+		assert.Equal(t, 100, val.(profile).Visits)
+	})
+
+	t.Run("A panicking function does not leave the cache locked", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+		assert.Panics(t, func() {
+			c.Update("key1", func(old any, found bool) (any, time.Duration, bool) {
+				panic("boom")
+			})
+		})
+
+		c.Set("key1", "value2", NoExpiration)
+		val, _ := c.Get("key1")
+		assert.Equal(t, "value2", val)
+	})
+}
+
+func TestCache_CompareAndSwap(t *testing.T) {
+	t.Run("Swap when the current value matches", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", time.Hour)
+		_, exp1, _ := c.GetWithExpiration("key1")
+
+		assert.True(t, c.CompareAndSwap("key1", "value1", "value2"))
+
+		val, exp2, found := c.GetWithExpiration("key1")
+		assert.True(t, found)
+		assert.Equal(t, "value2", val)
+		assert.Equal(t, exp1, exp2)
+	})
+
+	t.Run("Do not swap when the current value differs", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+
+		assert.False(t, c.CompareAndSwap("key1", "other", "value2"))
+
+		val, _ := c.Get("key1")
+		assert.Equal(t, "value1", val)
+	})
+
+	t.Run("Do not swap a missing or expired item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		assert.False(t, c.CompareAndSwap("key1", nil, "value1"))
+
+		c.Set("key2", "value2", time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+		assert.False(t, c.CompareAndSwap("key2", "value2", "value3"))
+	})
+}
+
+func TestCache_CompareAndDelete(t *testing.T) {
+	t.Run("Delete when the current value matches", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		var evicted any
+		c.OnEvicted(func(k string, v any) {
+			evicted = v
+		})
+		c.Set("key1", "value1", NoExpiration)
+
+		assert.True(t, c.CompareAndDelete("key1", "value1"))
+
+		_, found := c.Get("key1")
+		assert.False(t, found)
+		assert.Equal(t, "value1", evicted)
+	})
+
+	t.Run("Do not delete when the current value differs", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+
+		assert.False(t, c.CompareAndDelete("key1", "other"))
+
+		_, found := c.Get("key1")
+		assert.True(t, found)
+	})
+	t.Run("Comparing an uncomparable value does not leave the cache locked", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", []int{1}, NoExpiration)
+		assert.Panics(t, func() {
+			c.CompareAndDelete("key1", []int{1})
+		})
+
+		c.Delete("key1")
+		_, found := c.Get("key1")
+		assert.False(t, found)
+	})
+}
@@ -0,0 +1,31 @@
+package cache
+
+import "time"
+
+// GetWithVersion returns an item and its version from the cache. It returns
+// the item or nil, the version (0 if the item wasn't found), and a bool
+// indicating whether the key was found. The version can be passed to
+// SetIfVersion to update the item only if nobody else changed it since.
+func (c *Cache) GetWithVersion(k string) (any, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, found := c.lookup(k)
+	if !found {
+		return nil, 0, false
+	}
+	return item.Object, item.version, true
+}
+
+// SetIfVersion sets a new value for the cache key only if the current version
+// of the item equals version, like memcached's cas. Passing a version of 0
+// sets the value only if the item doesn't exist or has expired. Returns a
+// *VersionConflictError otherwise.
+func (c *Cache) SetIfVersion(k string, x any, d time.Duration, version uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if actual := c.versionOf(k); actual != version {
+		return &VersionConflictError{Key: k, Expected: version, Actual: actual}
+	}
+	c.set(k, x, d)
+	return nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_GetWithVersion(t *testing.T) {
+	t.Run("Versions increase on every write", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", 1, NoExpiration)
+		val, v1, found := c.GetWithVersion("key1")
+		assert.True(t, found)
+		assert.Equal(t, 1, val)
+		assert.NotZero(t, v1)
+
+		c.Set("key1", 1, NoExpiration)
+		_, v2, _ := c.GetWithVersion("key1")
+		assert.Greater(t, v2, v1)
+
+		assert.NoError(t, c.Increment("key1", 1))
+		_, v3, _ := c.GetWithVersion("key1")
+		assert.Greater(t, v3, v2)
+	})
+
+	t.Run("GetWithVersion non-existing item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		val, version, found := c.GetWithVersion("key1")
+		assert.False(t, found)
+		assert.Nil(t, val)
+		assert.Zero(t, version)
+	})
+}
+
+func TestCache_SetIfVersion(t *testing.T) {
+	t.Run("Set when the version matches", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+		_, version, _ := c.GetWithVersion("key1")
+
+		assert.NoError(t, c.SetIfVersion("key1", "value2", NoExpiration, version))
+
+		val, _ := c.Get("key1")
+		assert.Equal(t, "value2", val)
+	})
+
+	t.Run("Fail with a conflict when the item changed", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key1", "value1", NoExpiration)
+		_, version, _ := c.GetWithVersion("key1")
+		c.Set("key1", "other", NoExpiration)
+		_, current, _ := c.GetWithVersion("key1")
+
+		err := c.SetIfVersion("key1", "value2", NoExpiration, version)
+
+		assert.ErrorIs(t, err, ErrConflict)
+		var conflict *VersionConflictError
+		assert.ErrorAs(t, err, &conflict)
+		assert.Equal(t, &VersionConflictError{Key: "key1", Expected: version, Actual: current}, conflict)
+		val, _ := c.Get("key1")
+		assert.Equal(t, "other", val)
+	})
+
+	t.Run("Version 0 only sets a missing item", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+
+		assert.NoError(t, c.SetIfVersion("key1", "value1", NoExpiration, 0))
+		assert.ErrorIs(t, c.SetIfVersion("key1", "value2", NoExpiration, 0), ErrConflict)
+	})
+}
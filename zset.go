@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+)
+
+// ZMember is a member of a sorted set and its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// SortedSet is the value stored by the sorted set commands, e.g. ZAdd. Members
+// are ordered by score, then lexicographically.
+type SortedSet struct {
+	scores map[string]float64
+	list   *skipList
+}
+
+func newSortedSet() *SortedSet {
+	return &SortedSet{scores: make(map[string]float64), list: newSkipList()}
+}
+
+// Len returns the number of members in the set.
+func (z *SortedSet) Len() int {
+	return len(z.scores)
+}
+
+// add sets the score of member, returning true if it is a new member. The
+// score must not be NaN, since NaN doesn't order against other scores.
+func (z *SortedSet) add(member string, score float64) bool {
+	old, found := z.scores[member]
+	if found {
+		if old == score {
+			return false
+		}
+		z.list.delete(old, member)
+	}
+	z.scores[member] = score
+	z.list.insert(score, member)
+	return !found
+}
+
+func (z *SortedSet) remove(member string) bool {
+	score, found := z.scores[member]
+	if !found {
+		return false
+	}
+	delete(z.scores, member)
+	z.list.delete(score, member)
+	return true
+}
+
+// clone returns a copy of the set.
+func (z *SortedSet) clone() *SortedSet {
+	c := newSortedSet()
+	for x := z.list.header.levels[0].forward; x != nil; x = x.levels[0].forward {
+		c.add(x.member, x.score)
+	}
+	return c
+}
+
+// GobEncode encodes the set as its members in order.
+func (z *SortedSet) GobEncode() ([]byte, error) {
+	members := make([]ZMember, 0, z.Len())
+	for x := z.list.header.levels[0].forward; x != nil; x = x.levels[0].forward {
+		members = append(members, ZMember{x.member, x.score})
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(members)
+	return buf.Bytes(), err
+}
+
+// GobDecode decodes a set encoded by GobEncode.
+func (z *SortedSet) GobDecode(b []byte) error {
+	var members []ZMember
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&members); err != nil {
+		return err
+	}
+	*z = *newSortedSet()
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return ErrNaNScore
+		}
+		z.add(m.Member, m.Score)
+	}
+	return nil
+}
+
+// updateSortedSet calls f with the sorted set stored under k, creating an
+// empty one if the key doesn't exist or has expired. The key is deleted if the
+// set is empty once f returns.
+func (c *Cache) updateSortedSet(k string, f func(z *SortedSet)) error {
+	return updateValue(c, k, newSortedSet, func(z *SortedSet) bool {
+		f(z)
+		return z.Len() > 0
+	})
+}
+
+// readSortedSet calls f with the sorted set stored under k, or with an empty
+// set if the key doesn't exist or has expired.
+func (c *Cache) readSortedSet(k string, f func(z *SortedSet)) error {
+	return readValue(c, k, func(z *SortedSet, found bool) {
+		if !found {
+			z = newSortedSet()
+		}
+		f(z)
+	})
+}
+
+// ZAdd adds members to the sorted set stored under k, or updates their scores
+// if they are already members, creating the set if the key doesn't exist.
+// Returns the number of new members, or ErrNaNScore without changing the set
+// if a score is NaN.
+func (c *Cache) ZAdd(k string, members ...ZMember) (int, error) {
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNaNScore
+		}
+	}
+	var n int
+	err := c.updateSortedSet(k, func(z *SortedSet) {
+		for _, m := range members {
+			if z.add(m.Member, m.Score) {
+				n++
+			}
+		}
+	})
+	return n, err
+}
+
+// ZIncrBy increments the score of member in the sorted set stored under k by
+// incr, adding the member with a score of incr if it isn't in the set. Returns
+// the new score, or ErrNaNScore without changing the set if the new score
+// would be NaN, e.g. when adding -Inf to +Inf.
+func (c *Cache) ZIncrBy(k string, incr float64, member string) (float64, error) {
+	var score float64
+	err := c.updateSortedSet(k, func(z *SortedSet) {
+		score = z.scores[member] + incr
+		if !math.IsNaN(score) {
+			z.add(member, score)
+		}
+	})
+	if err == nil && math.IsNaN(score) {
+		return 0, ErrNaNScore
+	}
+	return score, err
+}
+
+// ZRem removes members from the sorted set stored under k. Returns the number
+// of members that were in the set. The key is deleted when its last member is
+// removed.
+func (c *Cache) ZRem(k string, members ...string) (int, error) {
+	var n int
+	err := c.updateSortedSet(k, func(z *SortedSet) {
+		for _, m := range members {
+			if z.remove(m) {
+				n++
+			}
+		}
+	})
+	return n, err
+}
+
+// ZScore returns the score of member in the sorted set stored under k, and a
+// bool indicating whether the member was found.
+func (c *Cache) ZScore(k string, member string) (float64, bool, error) {
+	var (
+		score float64
+		found bool
+	)
+	err := c.readSortedSet(k, func(z *SortedSet) {
+		score, found = z.scores[member]
+	})
+	return score, found, err
+}
+
+// ZRank returns the 0-based rank of member in the sorted set stored under k,
+// ordered from the lowest score, and a bool indicating whether the member was
+// found.
+func (c *Cache) ZRank(k string, member string) (int, bool, error) {
+	var (
+		rank  int
+		found bool
+	)
+	err := c.readSortedSet(k, func(z *SortedSet) {
+		var score float64
+		if score, found = z.scores[member]; found {
+			rank = z.list.rank(score, member)
+		}
+	})
+	return rank, found, err
+}
+
+// ZRangeByScore returns the members of the sorted set stored under k with a
+// score between min and max, both inclusive, ordered from the lowest score.
+func (c *Cache) ZRangeByScore(k string, min, max float64) ([]ZMember, error) {
+	res := []ZMember{}
+	err := c.readSortedSet(k, func(z *SortedSet) {
+		for x := z.list.firstInRange(min); x != nil && x.score <= max; x = x.levels[0].forward {
+			res = append(res, ZMember{x.member, x.score})
+		}
+	})
+	return res, err
+}
+
+// ZRangeByRank returns the members of the sorted set stored under k with a
+// rank between start and stop, both inclusive, ordered from the lowest score.
+// Negative ranks count from the highest score, so -1 is the last member. Out
+// of range ranks are clamped, as in Redis.
+func (c *Cache) ZRangeByRank(k string, start, stop int) ([]ZMember, error) {
+	res := []ZMember{}
+	err := c.readSortedSet(k, func(z *SortedSet) {
+		n := z.Len()
+		if start < 0 {
+			start += n
+		}
+		if stop < 0 {
+			stop += n
+		}
+		start = max(start, 0)
+		stop = min(stop, n-1)
+		if start > stop {
+			return
+		}
+		x := z.list.byRank(start)
+		for i := start; i <= stop; i++ {
+			res = append(res, ZMember{x.member, x.score})
+			x = x.levels[0].forward
+		}
+	})
+	return res, err
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores from
+// the sorted set stored under k, ordered from the lowest score.
+func (c *Cache) ZPopMin(k string, count int) ([]ZMember, error) {
+	res := []ZMember{}
+	err := c.updateSortedSet(k, func(z *SortedSet) {
+		for len(res) < count && z.Len() > 0 {
+			x := z.list.header.levels[0].forward
+			res = append(res, ZMember{x.member, x.score})
+			z.remove(x.member)
+		}
+	})
+	return res, err
+}
+
+// ZPopMax removes and returns up to count members with the highest scores
+// from the sorted set stored under k, ordered from the highest score.
+func (c *Cache) ZPopMax(k string, count int) ([]ZMember, error) {
+	res := []ZMember{}
+	err := c.updateSortedSet(k, func(z *SortedSet) {
+		for len(res) < count && z.Len() > 0 {
+			x := z.list.tail
+			res = append(res, ZMember{x.member, x.score})
+			z.remove(x.member)
+		}
+	})
+	return res, err
+}
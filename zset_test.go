@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupLeaderboard() *Cache {
+	c := New(DefaultExpiration, 0)
+	_, _ = c.ZAdd("board",
+		ZMember{"ana", 30},
+		ZMember{"bea", 10},
+		ZMember{"carl", 20},
+		ZMember{"dan", 20},
+	)
+	return c
+}
+
+func TestCache_ZAdd(t *testing.T) {
+	t.Run("Add new members and update existing ones", func(t *testing.T) {
+		c := setupLeaderboard()
+		n, err := c.ZAdd("board", ZMember{"ana", 5}, ZMember{"eve", 40})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		res, _ := c.ZRangeByRank("board", 0, -1)
+		assert.Equal(t, []ZMember{{"ana", 5}, {"bea", 10}, {"carl", 20}, {"dan", 20}, {"eve", 40}}, res)
+	})
+
+	t.Run("Add to a key holding another kind of value", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		c.Set("key", "value", NoExpiration)
+		_, err := c.ZAdd("key", ZMember{"a", 1})
+		assert.ErrorIs(t, err, ErrWrongType)
+	})
+
+	t.Run("Reject NaN scores", func(t *testing.T) {
+		c := setupLeaderboard()
+		n, err := c.ZAdd("board", ZMember{"eve", 1}, ZMember{"ana", math.NaN()})
+		assert.ErrorIs(t, err, ErrNaNScore)
+		assert.Equal(t, 0, n)
+
+		res, _ := c.ZRangeByRank("board", 0, -1)
+		assert.Equal(t, []ZMember{{"bea", 10}, {"carl", 20}, {"dan", 20}, {"ana", 30}}, res)
+	})
+}
+
+func TestCache_ZIncrBy(t *testing.T) {
+	t.Run("Increment existing and new members", func(t *testing.T) {
+		c := setupLeaderboard()
+		score, err := c.ZIncrBy("board", 25, "bea")
+		assert.NoError(t, err)
+		assert.Equal(t, 35.0, score)
+
+		score, _ = c.ZIncrBy("board", 1, "eve")
+		assert.Equal(t, 1.0, score)
+
+		rank, found, _ := c.ZRank("board", "bea")
+		assert.True(t, found)
+		assert.Equal(t, 4, rank)
+	})
+
+	t.Run("Reject increments resulting in NaN", func(t *testing.T) {
+		c := New(DefaultExpiration, 0)
+		score, err := c.ZIncrBy("zset", math.Inf(1), "a")
+		assert.NoError(t, err)
+		assert.Equal(t, math.Inf(1), score)
+
+		_, err = c.ZIncrBy("zset", math.Inf(-1), "a")
+		assert.ErrorIs(t, err, ErrNaNScore)
+		_, err = c.ZIncrBy("zset", math.NaN(), "b")
+		assert.ErrorIs(t, err, ErrNaNScore)
+
+		res, _ := c.ZPopMax("zset", 10)
+		assert.Equal(t, []ZMember{{"a", math.Inf(1)}}, res)
+		_, found := c.Get("zset")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_ZRem(t *testing.T) {
+	t.Run("Remove members and delete the empty set", func(t *testing.T) {
+		c := setupLeaderboard()
+		n, err := c.ZRem("board", "ana", "missing")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		_, _ = c.ZRem("board", "bea", "carl", "dan")
+		_, found := c.Get("board")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_ZScore(t *testing.T) {
+	t.Run("Get the score of a member", func(t *testing.T) {
+		c := setupLeaderboard()
+		score, found, err := c.ZScore("board", "carl")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, 20.0, score)
+
+		_, found, _ = c.ZScore("board", "missing")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_ZRank(t *testing.T) {
+	t.Run("Ties are ordered by member", func(t *testing.T) {
+		c := setupLeaderboard()
+		for i, m := range []string{"bea", "carl", "dan", "ana"} {
+			rank, found, err := c.ZRank("board", m)
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, i, rank)
+		}
+		_, found, _ := c.ZRank("board", "missing")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_ZRangeByScore(t *testing.T) {
+	t.Run("Range with inclusive bounds", func(t *testing.T) {
+		c := setupLeaderboard()
+		res, err := c.ZRangeByScore("board", 15, 30)
+		assert.NoError(t, err)
+		assert.Equal(t, []ZMember{{"carl", 20}, {"dan", 20}, {"ana", 30}}, res)
+
+		res, _ = c.ZRangeByScore("board", 31, 40)
+		assert.Empty(t, res)
+	})
+}
+
+func TestCache_ZRangeByRank(t *testing.T) {
+	t.Run("Range with negative ranks", func(t *testing.T) {
+		c := setupLeaderboard()
+		res, err := c.ZRangeByRank("board", -2, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, []ZMember{{"dan", 20}, {"ana", 30}}, res)
+
+		res, _ = c.ZRangeByRank("missing", 0, -1)
+		assert.Empty(t, res)
+	})
+}
+
+func TestCache_ZPopMin(t *testing.T) {
+	t.Run("Pop the lowest scores", func(t *testing.T) {
+		c := setupLeaderboard()
+		res, err := c.ZPopMin("board", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []ZMember{{"bea", 10}, {"carl", 20}}, res)
+
+		res, _ = c.ZPopMin("board", 5)
+		assert.Equal(t, []ZMember{{"dan", 20}, {"ana", 30}}, res)
+		_, found := c.Get("board")
+		assert.False(t, found)
+	})
+}
+
+func TestCache_ZPopMax(t *testing.T) {
+	t.Run("Pop the highest scores", func(t *testing.T) {
+		c := setupLeaderboard()
+		res, err := c.ZPopMax("board", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []ZMember{{"ana", 30}, {"dan", 20}}, res)
+	})
+}
+
+func TestSortedSet_Gob(t *testing.T) {
+	t.Run("Save and load a sorted set", func(t *testing.T) {
+		c := setupLeaderboard()
+		var buf bytes.Buffer
+		assert.NoError(t, c.Save(&buf))
+
+		c2 := New(DefaultExpiration, 0)
+		assert.NoError(t, c2.Load(&buf))
+
+		res, err := c2.ZRangeByRank("board", 0, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, []ZMember{{"bea", 10}, {"carl", 20}, {"dan", 20}, {"ana", 30}}, res)
+	})
+}
+
+func TestSkipList(t *testing.T) {
+	t.Run("Ranks match a sorted slice after random updates", func(t *testing.T) {
+		z := newSortedSet()
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 2000; i++ {
+			m := fmt.Sprintf("m%d", rnd.Intn(300))
+			if rnd.Intn(4) == 0 {
+				z.remove(m)
+			} else {
+				z.add(m, float64(rnd.Intn(50)))
+			}
+		}
+
+		var want []ZMember
+		for m, s := range z.scores {
+			want = append(want, ZMember{m, s})
+		}
+		sort.Slice(want, func(i, j int) bool {
+			return want[i].Score < want[j].Score || (want[i].Score == want[j].Score && want[i].Member < want[j].Member)
+		})
+		assert.Equal(t, len(want), z.list.length)
+		for i, m := range want {
+			assert.Equal(t, i, z.list.rank(m.Score, m.Member))
+			x := z.list.byRank(i)
+			assert.Equal(t, m, ZMember{x.member, x.score})
+		}
+		assert.Equal(t, want[len(want)-1].Member, z.list.tail.member)
+	})
+}